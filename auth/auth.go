@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/azzzak/alice"
+	"net/http"
+	"sync"
+	"yandex-dialogs/common"
+	"yandex-dialogs/config"
+)
+
+// Rejections counts rejected requests per dialog path.
+var Rejections = &Counter{counts: map[string]int{}}
+
+// Reasons of rejection. They are used as labels of metrics, so set of them is small and fixed.
+const (
+	ReasonSkillID = "skill_id"
+	ReasonSecret  = "secret"
+	ReasonHMAC    = "hmac"
+	ReasonUnknown = "unknown"
+)
+
+// Rejection is error of authenticator with reason of rejection.
+type Rejection struct {
+	Reason  string
+	message string
+}
+
+func (r *Rejection) Error() string {
+	return r.message
+}
+
+func reject(reason string, format string, args ...interface{}) error {
+	return &Rejection{Reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// ReasonOf returns reason of rejection by error of authenticator. Errors of custom authenticators have unknown reason.
+func ReasonOf(err error) string {
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		return rejection.Reason
+	}
+	return ReasonUnknown
+}
+
+// Authenticator checks that incoming request was really sent by Yandex Dialogs for the expected skill.
+// Returns nil if request is authentic, otherwise error with the reason of rejection.
+type Authenticator interface {
+	Authenticate(r *http.Request, body []byte, request *alice.Request) error
+}
+
+type AuthenticatorFunc func(r *http.Request, body []byte, request *alice.Request) error
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request, body []byte, request *alice.Request) error {
+	return f(r, body, request)
+}
+
+// SkillID accepts only requests with `session.skill_id` equal to expected one. Empty expected value disables the check.
+func SkillID(expected string) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request, body []byte, request *alice.Request) error {
+		if expected == "" {
+			return nil
+		}
+		if request.Session.SkillID != expected {
+			return reject(ReasonSkillID, "unexpected skill id %q", request.Session.SkillID)
+		}
+		return nil
+	})
+}
+
+// SharedSecret accepts only requests with header equal to the secret. Empty secret disables the check.
+func SharedSecret(header, secret string) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request, body []byte, request *alice.Request) error {
+		if secret == "" {
+			return nil
+		}
+		value := r.Header.Get(header)
+		if value == "" {
+			return reject(ReasonSecret, "header %s is missing", header)
+		}
+		if subtle.ConstantTimeCompare([]byte(value), []byte(secret)) != 1 {
+			return reject(ReasonSecret, "header %s is incorrect", header)
+		}
+		return nil
+	})
+}
+
+// HMAC accepts only requests with header containing hex encoded HMAC-SHA256 of the body. Empty key disables the check.
+func HMAC(header, key string) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request, body []byte, request *alice.Request) error {
+		if key == "" {
+			return nil
+		}
+		signature, err := hex.DecodeString(r.Header.Get(header))
+		if err != nil || len(signature) == 0 {
+			return reject(ReasonHMAC, "header %s is missing or malformed", header)
+		}
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(body)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return reject(ReasonHMAC, "signature mismatch")
+		}
+		return nil
+	})
+}
+
+// Chain accepts request only if all authenticators accept it.
+func Chain(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request, body []byte, request *alice.Request) error {
+		for _, a := range authenticators {
+			if err := a.Authenticate(r, body, request); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ForSkill builds default authenticator for dialog: skill id check plus shared secret and HMAC checks configured by settings.
+func ForSkill(skillID string, settings config.Auth) Authenticator {
+	return Chain(
+		SkillID(skillID),
+		SharedSecret(settings.SecretHeader, settings.SharedSecret),
+		HMAC(settings.HMACHeader, settings.HMACKey),
+	)
+}
+
+type Counter struct {
+	mux    sync.Mutex
+	counts map[string]int
+}
+
+func (c *Counter) Inc(key string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.counts[key]++
+}
+
+func (c *Counter) Snapshot() map[string]int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	snapshot := make(map[string]int, len(c.counts))
+	for k, v := range c.counts {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// Bearer allows requests to handler only with `Authorization: Bearer <token>` header.
+// Empty token denies all requests, so service endpoints are not exposed by mistake.
+func Bearer(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := common.BearerAuthHeader(r.Header.Get("Authorization"))
+		if token == "" || provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Unauthorized access"}`))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
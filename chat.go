@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/azzzak/alice"
+	"io"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"yandex-dialogs/simulator"
+)
+
+const chatHelp = `Say phrases to dialog, or use commands:
+  /user NAME  switch to user NAME, new users are created on the fly
+  /users      list users
+  /new        start new session of current user
+  /speaker    switch current user between speaker without screen and phone
+  /help       show this help
+  /quit       exit
+`
+
+// chat runs dialog in-process and talks to it from console on behalf of simulated users.
+// Dialog uses the same settings as server, e.g. MAIL_STORE=memory keeps voice mail without DB.
+func chat(args []string) int {
+	flags := flag.NewFlagSet("chat", flag.ExitOnError)
+	name := flags.String("dialog", "", "Name of dialog to talk to, or the last element of its path, for example `voice-mail`")
+	userID := flags.String("user", "test", "Id of the first user")
+	flags.Parse(args)
+
+	cfg := loadConfig()
+	dialog, err := offlineDialog(cfg, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	h, closeDialog, err := offlineHandler(dialog, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot init dialog %s: %v\n", *name, err)
+		return 2
+	}
+	defer closeDialog()
+
+	console := &chatConsole{
+		path:  dialog.GetPath(),
+		users: map[string]*simulator.User{},
+		out:   os.Stdout,
+		say: func(body []byte) ([]byte, int) {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest("POST", dialog.GetPath(), bytes.NewReader(body)))
+			return w.Body.Bytes(), w.Code
+		},
+	}
+	console.switchUser(*userID)
+	fmt.Fprint(os.Stdout, chatHelp)
+	console.run(os.Stdin)
+	return 0
+}
+
+type chatConsole struct {
+	path  string
+	users map[string]*simulator.User
+	user  *simulator.User
+	out   io.Writer
+	say   func(body []byte) ([]byte, int)
+}
+
+func (c *chatConsole) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	c.prompt()
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		switch {
+		case line == "/quit":
+			return
+		case line == "/help":
+			fmt.Fprint(c.out, chatHelp)
+		case line == "/new":
+			c.user.NewSession()
+			fmt.Fprintf(c.out, "Next phrase of %s starts new session\n", c.user.ID)
+		case line == "/speaker":
+			c.user.Speaker = !c.user.Speaker
+			if c.user.Speaker {
+				fmt.Fprintf(c.out, "%s talks from speaker without screen\n", c.user.ID)
+			} else {
+				fmt.Fprintf(c.out, "%s talks from phone\n", c.user.ID)
+			}
+		case line == "/users":
+			c.listUsers()
+		case len(fields) == 2 && fields[0] == "/user":
+			c.switchUser(fields[1])
+		case strings.HasPrefix(line, "/"):
+			fmt.Fprintf(c.out, "Unknown command %s\n%s", line, chatHelp)
+		default:
+			c.send(line)
+		}
+		c.prompt()
+	}
+}
+
+func (c *chatConsole) prompt() {
+	fmt.Fprintf(c.out, "%s> ", c.user.ID)
+}
+
+func (c *chatConsole) switchUser(id string) {
+	user, ok := c.users[id]
+	if !ok {
+		user = simulator.NewUser(id)
+		c.users[id] = user
+	}
+	c.user = user
+}
+
+func (c *chatConsole) listUsers() {
+	var ids []string
+	for id := range c.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintln(c.out, id)
+	}
+}
+
+func (c *chatConsole) send(text string) {
+	body, err := c.user.Marshal(c.user.Request(text))
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	answer, code := c.say(body)
+	response := &alice.Response{}
+	if code != 200 {
+		fmt.Fprintf(c.out, "Dialog responded with status %d: %s\n", code, answer)
+		return
+	}
+	if err := json.Unmarshal(answer, response); err != nil {
+		fmt.Fprintf(c.out, "Cannot read response: %v\n", err)
+		return
+	}
+	if err := c.user.Remember(answer); err != nil {
+		fmt.Fprintf(c.out, "Cannot read state of response: %v\n", err)
+	}
+	printResponse(c.out, response)
+	if response.Response.EndSession {
+		c.user.NewSession()
+	}
+}
+
+func printResponse(out io.Writer, response *alice.Response) {
+	fmt.Fprintln(out, response.Response.Text)
+	if tts := response.Response.TTS; tts != "" && tts != response.Response.Text {
+		fmt.Fprintf(out, "tts: %s\n", tts)
+	}
+	if response.Response.Card != nil {
+		card, _ := json.Marshal(response.Response.Card)
+		fmt.Fprintf(out, "card: %s\n", card)
+	}
+	var buttons []string
+	for _, button := range response.Response.Buttons {
+		if button.URL != "" {
+			buttons = append(buttons, fmt.Sprintf("[%s -> %s]", button.Title, button.URL))
+		} else {
+			buttons = append(buttons, fmt.Sprintf("[%s]", button.Title))
+		}
+	}
+	if len(buttons) > 0 {
+		fmt.Fprintln(out, strings.Join(buttons, " "))
+	}
+	if response.Response.EndSession {
+		fmt.Fprintln(out, "(session ended)")
+	}
+}
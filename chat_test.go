@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/azzzak/alice"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"yandex-dialogs/auth"
+	"yandex-dialogs/common"
+	"yandex-dialogs/harness"
+	"yandex-dialogs/simulator"
+	"yandex-dialogs/statistics"
+)
+
+// counterDialog answers with number of phrases of user, kept in session store.
+type counterDialog struct {
+	panicDialog
+	states common.SessionStore
+}
+
+func (d *counterDialog) HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+		count := 0
+		if _, err := d.states.Get(ctx, request.Session.UserID, &count); err != nil {
+			return response.Text(err.Error())
+		}
+		count++
+		if err := d.states.Set(ctx, request.Session.UserID, count); err != nil {
+			return response.Text(err.Error())
+		}
+		return response.Text("Фраза " + strconv.Itoa(count))
+	}
+}
+
+func TestChatEchoesAliceState(t *testing.T) {
+	tests := []struct {
+		store string
+		// expected answer to the first phrase of the next session
+		afterNewSession string
+	}{
+		{"alice", "Фраза 1"},
+		{"alice_user", "Фраза 3"},
+	}
+	for _, test := range tests {
+		dialog := &counterDialog{panicDialog: panicDialog{path: "/test/counter"}}
+		dialog.states = harness.NewDependencies(map[string]string{"SESSION_STORE": test.store}).SessionStore("counter")
+		h := handleRequest(dialog, nil, auth.AuthenticatorFunc(func(*http.Request, []byte, *alice.Request) error {
+			return nil
+		}), statistics.NewAggregator(nil), nil)
+		out := &bytes.Buffer{}
+		console := &chatConsole{
+			path:  dialog.GetPath(),
+			users: map[string]*simulator.User{},
+			out:   out,
+			say: func(body []byte) ([]byte, int) {
+				w := httptest.NewRecorder()
+				h(w, httptest.NewRequest("POST", dialog.GetPath(), bytes.NewReader(body)))
+				return w.Body.Bytes(), w.Code
+			},
+		}
+		console.switchUser("user")
+		console.run(strings.NewReader("привет\nещё\n/new\nснова\n"))
+
+		for _, answer := range []string{"Фраза 1\n", "Фраза 2\n", test.afterNewSession + "\n"} {
+			i := strings.Index(out.String(), answer)
+			if i < 0 {
+				t.Fatalf("%s store: expected answer %q in chat:\n%s", test.store, answer, out.String())
+			}
+			out.Next(i + len(answer))
+		}
+	}
+}
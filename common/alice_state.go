@@ -0,0 +1,146 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/azzzak/alice"
+	"sync"
+)
+
+// StateRequest contains fields of Alice request, which are not exposed by azzzak/alice v0.1.0: state and interfaces.
+type StateRequest struct {
+	Meta struct {
+		Interfaces struct {
+			AccountLinking *struct{} `json:"account_linking"`
+		} `json:"interfaces"`
+	} `json:"meta"`
+	State struct {
+		Session map[string]json.RawMessage `json:"session,omitempty"`
+		User    map[string]json.RawMessage `json:"user,omitempty"`
+	} `json:"state"`
+}
+
+// StateResponse is Alice response extended with state fields.
+type StateResponse struct {
+	*alice.Response
+	SessionState    map[string]json.RawMessage `json:"session_state,omitempty"`
+	UserStateUpdate map[string]json.RawMessage `json:"user_state_update,omitempty"`
+}
+
+// RequestState is state of single request in flight, filled from `state` of incoming request and flushed into
+// `session_state` and `user_state_update` of response. It is passed to dialog in context of request, so states of
+// overlapping requests of the same user do not mix.
+type RequestState struct {
+	// accountLinking is set on start and read-only after
+	accountLinking bool
+
+	mux        sync.Mutex
+	session    map[string]json.RawMessage
+	user       map[string]json.RawMessage
+	userUpdate map[string]json.RawMessage
+}
+
+// NewRequestState returns state of incoming request.
+func NewRequestState(request *StateRequest) *RequestState {
+	state := &RequestState{
+		accountLinking: request.Meta.Interfaces.AccountLinking != nil,
+		session:        map[string]json.RawMessage{},
+		user:           map[string]json.RawMessage{},
+		userUpdate:     map[string]json.RawMessage{},
+	}
+	for k, v := range request.State.Session {
+		state.session[k] = v
+	}
+	for k, v := range request.State.User {
+		state.user[k] = v
+	}
+	return state
+}
+
+// Response builds response with state which should be sent back to Alice.
+func (s *RequestState) Response(resp *alice.Response) *StateResponse {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return &StateResponse{Response: resp, SessionState: s.session, UserStateUpdate: s.userUpdate}
+}
+
+type requestStateKey struct{}
+
+// WithRequestState returns context of request carrying its state.
+func WithRequestState(ctx context.Context, state *RequestState) context.Context {
+	return context.WithValue(ctx, requestStateKey{}, state)
+}
+
+func requestStateOf(ctx context.Context) *RequestState {
+	state, _ := ctx.Value(requestStateKey{}).(*RequestState)
+	return state
+}
+
+// AliceStore keeps state of dialog in Alice itself: state is sent in response and returned in the next request.
+// Session scoped state lives until the end of session, user scoped state is kept by Alice for authorized users.
+// Store works only in context of request being handled by server, key is ignored, because state belongs to request.
+type AliceStore struct {
+	name string
+	user bool
+}
+
+func NewAliceStore(name string, user bool) *AliceStore {
+	return &AliceStore{name: name, user: user}
+}
+
+func (s *AliceStore) Get(ctx context.Context, key string, value interface{}) (bool, error) {
+	state := requestStateOf(ctx)
+	if state == nil {
+		return false, nil
+	}
+	state.mux.Lock()
+	defer state.mux.Unlock()
+	data, ok := state.session[s.name]
+	if s.user {
+		data, ok = state.user[s.name]
+	}
+	if !ok || data == nil || string(data) == "null" {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+func (s *AliceStore) Set(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.put(ctx, data)
+}
+
+func (s *AliceStore) Delete(ctx context.Context, key string) error {
+	if s.user {
+		// null in user_state_update removes the value
+		return s.put(ctx, json.RawMessage("null"))
+	}
+	state := requestStateOf(ctx)
+	if state == nil {
+		return nil
+	}
+	state.mux.Lock()
+	defer state.mux.Unlock()
+	delete(state.session, s.name)
+	return nil
+}
+
+func (s *AliceStore) put(ctx context.Context, data json.RawMessage) error {
+	state := requestStateOf(ctx)
+	if state == nil {
+		return errors.New("there is no request in context")
+	}
+	state.mux.Lock()
+	defer state.mux.Unlock()
+	if s.user {
+		state.user[s.name] = data
+		state.userUpdate[s.name] = data
+	} else {
+		state.session[s.name] = data
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestStatesOfOverlappingRequestsDoNotMix(t *testing.T) {
+	request := &StateRequest{}
+	request.State.Session = map[string]json.RawMessage{"dialog": json.RawMessage(`"start"`)}
+	first := NewRequestState(request)
+	second := NewRequestState(request)
+	store := NewAliceStore("dialog", false)
+
+	// both requests are of the same user
+	if err := store.Set(WithRequestState(context.Background(), first), "user", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(WithRequestState(context.Background(), second), "user"); err != nil {
+		t.Fatal(err)
+	}
+	var value string
+	if ok, err := store.Get(WithRequestState(context.Background(), first), "user", &value); !ok || err != nil || value != "first" {
+		t.Errorf("expected state of the first request, got %q, %v, %v", value, ok, err)
+	}
+	if ok, _ := store.Get(WithRequestState(context.Background(), second), "user", &value); ok {
+		t.Error("expected state of the second request to be deleted")
+	}
+	if err := store.Set(context.Background(), "user", "lost"); err == nil {
+		t.Error("expected error without request in context")
+	}
+	if string(first.Response(nil).SessionState["dialog"]) != `"first"` || len(second.Response(nil).SessionState) != 0 {
+		t.Errorf("unexpected session states %v and %v", first.Response(nil).SessionState, second.Response(nil).SessionState)
+	}
+}
@@ -1,28 +1,12 @@
 package common
 
 import (
-	"fmt"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
+	"yandex-dialogs/logging"
 )
 
-func GetEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
-}
-
-func GetInt(strValue string, defaultValue int64) int64 {
-	intValue, err := strconv.ParseInt(strValue, 10, 64)
-	if err != nil {
-		fmt.Printf("Incorrect int value, default value %+v will be used ", defaultValue)
-		return defaultValue
-	}
-	return intValue
-}
+var logger = logging.For("common")
 
 func Handler() func(func(w http.ResponseWriter, r *http.Request)) http.Handler {
 	return func(f func(w http.ResponseWriter, r *http.Request)) http.Handler {
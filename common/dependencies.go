@@ -0,0 +1,105 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-bongo/bongo"
+	"net/http"
+	"sync"
+	"time"
+	"yandex-dialogs/config"
+	"yandex-dialogs/metrics"
+)
+
+// Connections is a pool of MongoDB connections shared by dialogs. Dialogs using the same DB get the same connection.
+type Connections struct {
+	mux         sync.Mutex
+	connections map[string]*bongo.Connection
+}
+
+func NewConnections() *Connections {
+	return &Connections{connections: map[string]*bongo.Connection{}}
+}
+
+// Get returns connection to database, dialing it on first use.
+func (c *Connections) Get(connectionString, database string) (*bongo.Connection, error) {
+	if connectionString == "" {
+		return nil, errors.New("connection string to " + database + " DB is not configured")
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	key := connectionString + "|" + database
+	if connection, ok := c.connections[key]; ok {
+		return connection, nil
+	}
+	connection, err := bongo.Connect(&bongo.Config{
+		ConnectionString: connectionString,
+		Database:         database,
+	})
+	if err != nil {
+		return nil, err
+	}
+	connection.Session.SetPoolLimit(50)
+	c.connections[key] = connection
+	return connection, nil
+}
+
+// Ping checks connection of the pool. If ping fails, sockets of connection are refreshed, so that the next queries dial DB
+// again instead of failing on broken sockets. Connections are checked by health checks of dialogs, not on each request.
+func (c *Connections) Ping(connection *bongo.Connection) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("ping of DB failed: %v", r)
+		}
+	}()
+	if err = connection.Session.Ping(); err != nil {
+		connection.Session.Refresh()
+	}
+	return err
+}
+
+// Close closes all sockets of all connections.
+func (c *Connections) Close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for key, connection := range c.connections {
+		if connection.Session != nil {
+			connection.Session.Close()
+		}
+		delete(c.connections, key)
+	}
+}
+
+// Dependencies are shared resources injected into dialogs on init.
+type Dependencies struct {
+	Config     *config.Config
+	HttpClient *http.Client
+	Mongo      *Connections
+}
+
+func NewDependencies(cfg *config.Config) *Dependencies {
+	return &Dependencies{
+		Config:     cfg,
+		HttpClient: &http.Client{Timeout: 20 * time.Second},
+		Mongo:      NewConnections(),
+	}
+}
+
+// UpstreamClient returns client sharing connections with HttpClient, which reports metrics of requests under upstream name.
+// Zero timeout means timeout of HttpClient.
+func (d *Dependencies) UpstreamClient(upstream string, timeout time.Duration) *http.Client {
+	if timeout == 0 {
+		timeout = d.HttpClient.Timeout
+	}
+	return &http.Client{Transport: metrics.Transport(upstream, d.HttpClient.Transport), Timeout: timeout}
+}
+
+// SessionStore creates session store of dialog with given name, configured by sessions settings.
+func (d *Dependencies) SessionStore(name string) SessionStore {
+	return NewSessionStore(name, d.Config, d.Mongo)
+}
+
+// Close releases shared resources. Should be called after all dialogs are closed.
+func (d *Dependencies) Close() {
+	d.Mongo.Close()
+}
@@ -0,0 +1,19 @@
+package common
+
+import (
+	"context"
+	"github.com/azzzak/alice"
+)
+
+// HasScreen reports whether device of user has screen, like phone or TV. Speakers without screen do not show
+// buttons and cards, so dialogs should tell everything by voice and keep it short.
+func HasScreen(request *alice.Request) bool {
+	return request.HasScreen()
+}
+
+// CanLinkAccount reports whether user can authorize in skill on device, which sent request in context. It is known only
+// for requests being handled by server, because azzzak/alice v0.1.0 does not expose `meta.interfaces.account_linking`.
+func CanLinkAccount(ctx context.Context) bool {
+	state := requestStateOf(ctx)
+	return state != nil && state.accountLinking
+}
@@ -0,0 +1,19 @@
+package common
+
+import (
+	"context"
+	"github.com/robfig/cron/v3"
+)
+
+// StopCron stops scheduling of new jobs and waits for running ones until ctx is done.
+func StopCron(ctx context.Context, c *cron.Cron) error {
+	if c == nil {
+		return nil
+	}
+	select {
+	case <-c.Stop().Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-bongo/bongo"
+	"github.com/patrickmn/go-cache"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	"yandex-dialogs/config"
+	"yandex-dialogs/metrics"
+)
+
+// SessionStore keeps per-user state of dialog between requests.
+// Values are stored as JSON, so only exported fields of value are kept. Context is context of request being handled.
+type SessionStore interface {
+	// Get loads value stored by key into value. Returns false if there is no value for the key.
+	Get(ctx context.Context, key string, value interface{}) (bool, error)
+
+	// Set stores value by key and prolongs its TTL.
+	Set(ctx context.Context, key string, value interface{}) error
+
+	// Delete removes value by key.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewSessionStore creates store configured by sessions settings: `memory`, `mongo`, `alice` or `alice_user` store.
+// Name separates states of different dialogs in shared backends.
+func NewSessionStore(name string, cfg *config.Config, connections *Connections) SessionStore {
+	settings := cfg.Sessions
+	ttl := settings.TTL()
+	switch settings.Store {
+	case "alice":
+		return NewAliceStore(name, false)
+	case "alice_user":
+		return NewAliceStore(name, true)
+	case "mongo":
+		connectionString, database := settings.MongoConnection, settings.DatabaseName
+		if connectionString == "" {
+			connectionString = cfg.Common.MongoConnection
+		}
+		if database == "" {
+			database = cfg.Common.DatabaseName
+		}
+		connection, err := connections.Get(connectionString, database)
+		if err == nil {
+			return NewMongoStore(connection, "sessions_"+name, ttl)
+		}
+		logger.Errorf("Cannot connect to session store DB, in-memory store will be used: %v", err)
+	case "memory":
+	default:
+		logger.Warnf("Unknown session store %s, in-memory store will be used", settings.Store)
+	}
+	return NewMemoryStore(ttl)
+}
+
+// MemoryStore keeps states in process memory. It is safe for concurrent use and drops states after TTL.
+type MemoryStore struct {
+	cache *cache.Cache
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{cache: cache.New(ttl, ttl*2)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string, value interface{}) (bool, error) {
+	data, ok := s.cache.Get(key)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data.([]byte), value)
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.cache.SetDefault(key, data)
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.cache.Delete(key)
+	return nil
+}
+
+// MongoStore keeps states in MongoDB collection, so they survive restarts and are shared between instances.
+// Expired states are removed by TTL index.
+type MongoStore struct {
+	collection *bongo.Collection
+	ttl        time.Duration
+}
+
+type sessionDocument struct {
+	Key     string    `bson:"key"`
+	Value   string    `bson:"value"`
+	Updated time.Time `bson:"updated"`
+}
+
+func NewMongoStore(connection *bongo.Connection, collection string, ttl time.Duration) *MongoStore {
+	store := &MongoStore{collection: connection.Collection(collection), ttl: ttl}
+	err := store.collection.Collection().EnsureIndex(mgo.Index{Key: []string{"key"}, Unique: true})
+	if err != nil {
+		logger.Errorf("Cannot create key index for %s: %v", collection, err)
+	}
+	err = store.collection.Collection().EnsureIndex(mgo.Index{Key: []string{"updated"}, ExpireAfter: ttl})
+	if err != nil {
+		logger.Errorf("Cannot create TTL index for %s: %v", collection, err)
+	}
+	return store
+}
+
+func (s *MongoStore) Get(ctx context.Context, key string, value interface{}) (bool, error) {
+	document := &sessionDocument{}
+	defer metrics.ObserveMongo("sessions", "find", time.Now())
+	err := s.collection.Collection().Find(bson.M{"key": key}).One(document)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// TTL monitor of MongoDB runs once a minute, so expired document can still be found
+	if time.Since(document.Updated) > s.ttl {
+		return false, nil
+	}
+	return true, json.Unmarshal([]byte(document.Value), value)
+}
+
+func (s *MongoStore) Set(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	defer metrics.ObserveMongo("sessions", "save", time.Now())
+	_, err = s.collection.Collection().Upsert(bson.M{"key": key},
+		&sessionDocument{Key: key, Value: string(data), Updated: time.Now()})
+	return err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, key string) error {
+	defer metrics.ObserveMongo("sessions", "delete", time.Now())
+	err := s.collection.DeleteOne(bson.M{"key": key})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,340 @@
+// Package config loads settings of server and dialogs into typed structs.
+//
+// Each setting is a field tagged with `env`, the name of environment variable, and `yaml`, the key in its section
+// of optional YAML or JSON file set by CONFIG_FILE. Environment overrides the file, `default` tag is used if neither is set.
+// Settings tagged `required` must be set for enabled dialogs, settings tagged `secret` are hidden in Report.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is effective configuration of server. Problems found on load are reported by Validate and DialogError.
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Auth       Auth       `yaml:"auth"`
+	Logging    Logging    `yaml:"logging"`
+	Common     Common     `yaml:"common"`
+	Sessions   Sessions   `yaml:"sessions"`
+	Statistics Statistics `yaml:"statistics"`
+	Recorder   Recorder   `yaml:"recorder"`
+	Dialogs    Dialogs    `yaml:"dialogs"`
+	// Mounts are dialogs served by server, all registered dialogs on default paths if empty.
+	// Mounts are read from `mounts` list of file, or from DIALOGS, like `voice-mail,masha=/api/dialogs/masha-2`.
+	Mounts []Mount
+
+	settings []Setting
+	problems map[string][]string
+}
+
+// Setting describes effective value of setting. Value of secret setting is masked.
+type Setting struct {
+	Key    string
+	Env    string
+	Value  string
+	Source string
+}
+
+const (
+	SourceValues  = "values"
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+const secretMask = "******"
+
+// Mount is dialog served by server. Empty path means default path of dialog. Options are specific to dialog.
+type Mount struct {
+	Dialog  string            `yaml:"dialog" json:"dialog"`
+	Path    string            `yaml:"path" json:"path"`
+	Options map[string]string `yaml:"options" json:"options"`
+}
+
+func (m Mount) String() string {
+	if m.Path == "" {
+		return m.Dialog
+	}
+	return m.Dialog + "=" + m.Path
+}
+
+// Load reads configuration from environment and file, if file is not empty. Error is returned only if file can not be read,
+// invalid values are reported by Validate and DialogError.
+func Load(file string) (*Config, error) {
+	values := map[string]string{}
+	var mounts []Mount
+	if file != "" {
+		var err error
+		if values, mounts, err = readFile(file); err != nil {
+			return nil, err
+		}
+	}
+	c := load(nil, os.LookupEnv, values)
+	c.loadMounts(nil, os.LookupEnv, mounts)
+	return c, nil
+}
+
+// New returns configuration with values by env names, reading settings missing in values from environment.
+// It is used in tests and tools, which set settings explicitly.
+func New(values map[string]string) *Config {
+	c := load(values, os.LookupEnv, nil)
+	c.loadMounts(values, os.LookupEnv, nil)
+	return c
+}
+
+func load(values map[string]string, lookupEnv func(string) (string, bool), file map[string]string) *Config {
+	c := &Config{problems: map[string][]string{}}
+	known := map[string]bool{}
+	walk(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value, tag reflect.StructTag) {
+		known[key] = true
+		env := tag.Get("env")
+		value, source := tag.Get("default"), SourceDefault
+		if v, ok := file[key]; ok {
+			value, source = v, SourceFile
+		}
+		if v, ok := lookupEnv(env); ok {
+			value, source = v, SourceEnv
+		}
+		if v, ok := values[env]; ok {
+			value, source = v, SourceValues
+		}
+		if err := set(field, value); err != nil {
+			c.problem(key, fmt.Sprintf("%s has invalid value %q: %v", env, value, err))
+		}
+		if tag.Get("required") == "true" && value == "" {
+			c.problem(key, fmt.Sprintf("%s is required", env))
+		}
+		if tag.Get("secret") == "true" && value != "" {
+			value = secretMask
+		}
+		c.settings = append(c.settings, Setting{Key: key, Env: env, Value: value, Source: source})
+	})
+	for key := range file {
+		if !known[key] {
+			c.problem("config", fmt.Sprintf("unknown setting %s in config file", key))
+		}
+	}
+	walkSections(reflect.ValueOf(c).Elem(), "", func(key string, section reflect.Value) {
+		if v, ok := section.Addr().Interface().(validator); ok {
+			for _, problem := range v.validate(c) {
+				c.problem(key+".", problem)
+			}
+		}
+	})
+	return c
+}
+
+// loadMounts sets mounts from DIALOGS in values or environment, or from file.
+func (c *Config) loadMounts(values map[string]string, lookupEnv func(string) (string, bool), file []Mount) {
+	value, source := "", SourceDefault
+	if len(file) > 0 {
+		c.Mounts, source = file, SourceFile
+	}
+	if v, ok := lookupEnv("DIALOGS"); ok {
+		value, source = v, SourceEnv
+	}
+	if v, ok := values["DIALOGS"]; ok {
+		value, source = v, SourceValues
+	}
+	if source == SourceEnv || source == SourceValues {
+		c.Mounts = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			parts := strings.SplitN(item, "=", 2)
+			mount := Mount{Dialog: strings.TrimSpace(parts[0])}
+			if len(parts) == 2 {
+				mount.Path = strings.TrimSpace(parts[1])
+			}
+			c.Mounts = append(c.Mounts, mount)
+		}
+	}
+	var mounts []string
+	for _, m := range c.Mounts {
+		if m.Dialog == "" {
+			c.problem("mounts", "mount without dialog name")
+		}
+		mounts = append(mounts, m.String())
+	}
+	c.settings = append(c.settings, Setting{Key: "mounts", Env: "DIALOGS", Value: strings.Join(mounts, ","), Source: source})
+}
+
+// validator is implemented by sections with constraints, which can not be expressed by tags.
+type validator interface {
+	validate(c *Config) []string
+}
+
+func (c *Config) problem(key, problem string) {
+	section := sectionOf(key)
+	c.problems[section] = append(c.problems[section], problem)
+}
+
+// sectionOf returns section of setting key: the top level section, or section of dialog.
+func sectionOf(key string) string {
+	parts := strings.SplitN(key, ".", 3)
+	if parts[0] == "dialogs" && len(parts) > 1 {
+		return parts[0] + "." + parts[1]
+	}
+	return parts[0]
+}
+
+// Validate returns error describing problems of server settings. Problems of dialogs are reported by DialogError.
+func (c *Config) Validate() error {
+	var problems []string
+	for section, p := range c.problems {
+		if !strings.HasPrefix(section, "dialogs.") {
+			problems = append(problems, p...)
+		}
+	}
+	return problemsError(problems)
+}
+
+// DialogError returns error describing problems of settings of dialog by name, nil if dialog is configured correctly.
+func (c *Config) DialogError(name string) error {
+	return problemsError(c.problems["dialogs."+name])
+}
+
+func problemsError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	sorted := append([]string{}, problems...)
+	sort.Strings(sorted)
+	return fmt.Errorf("invalid config: %s", strings.Join(sorted, "; "))
+}
+
+// Enabled reports whether dialog is enabled by name of its section. Dialogs without section are enabled.
+func (c *Config) Enabled(name string) bool {
+	for _, s := range c.settings {
+		if s.Key == "dialogs."+name+".enabled" {
+			enabled, _ := strconv.ParseBool(s.Value)
+			return enabled
+		}
+	}
+	return true
+}
+
+// Report returns effective settings sorted by key. Secrets are masked.
+func (c *Config) Report() []Setting {
+	report := append([]Setting{}, c.settings...)
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Key < report[j].Key
+	})
+	return report
+}
+
+// walk calls f for each setting of struct v, addressed by key of its section, like `dialogs.masha.url`.
+func walk(v reflect.Value, prefix string, f func(key string, field reflect.Value, tag reflect.StructTag)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("yaml")
+		if field.PkgPath != "" || key == "" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), prefix+key+".", f)
+		} else {
+			f(prefix+key, v.Field(i), field.Tag)
+		}
+	}
+}
+
+// walkSections calls f for each nested section of struct v, including v itself.
+func walkSections(v reflect.Value, key string, f func(key string, section reflect.Value)) {
+	f(key, v)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath == "" && field.Type.Kind() == reflect.Struct && field.Tag.Get("yaml") != "" {
+			walkSections(v.Field(i), strings.TrimPrefix(key+"."+field.Tag.Get("yaml"), "."), f)
+		}
+	}
+}
+
+func set(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			field.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if value == "" {
+			field.SetInt(0)
+			return nil
+		}
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// readFile reads YAML or JSON file, depending on extension, into values by setting key and mounts.
+func readFile(file string) (map[string]string, []Mount, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var content map[string]interface{}
+	var mounts struct {
+		Mounts []Mount `yaml:"mounts" json:"mounts"`
+	}
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		if err = json.Unmarshal(data, &content); err == nil {
+			err = json.Unmarshal(data, &mounts)
+		}
+	} else {
+		if err = yaml.Unmarshal(data, &content); err == nil {
+			err = yaml.Unmarshal(data, &mounts)
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse config file %s: %v", file, err)
+	}
+	delete(content, "mounts")
+	values := map[string]string{}
+	flatten(content, "", values)
+	return values, mounts.Mounts, nil
+}
+
+func flatten(content interface{}, prefix string, values map[string]string) {
+	switch v := content.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			flatten(value, prefix+key+".", values)
+		}
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			flatten(value, prefix+fmt.Sprint(key)+".", values)
+		}
+	case nil:
+		values[strings.TrimSuffix(prefix, ".")] = ""
+	case float64:
+		values[strings.TrimSuffix(prefix, ".")] = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		values[strings.TrimSuffix(prefix, ".")] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"time"
+)
+
+type Server struct {
+	Host string `yaml:"host" env:"SERVER_HOST"`
+	Port string `yaml:"port" env:"PORT" default:"8080"`
+	// Heroku kills the process 30 seconds after SIGTERM
+	ShutdownTimeoutSeconds int64 `yaml:"shutdown_timeout_seconds" env:"SHUTDOWN_TIMEOUT_SECONDS" default:"25"`
+	// Alice waits for response about 3 seconds, the rest is left for network
+	ResponseTimeoutMs          int64 `yaml:"response_timeout_ms" env:"RESPONSE_TIMEOUT_MS" default:"2500"`
+	HealthCheckIntervalSeconds int64 `yaml:"health_check_interval_seconds" env:"HEALTH_CHECK_INTERVAL" default:"30"`
+}
+
+func (s Server) ShutdownTimeout() time.Duration {
+	return time.Duration(s.ShutdownTimeoutSeconds) * time.Second
+}
+
+func (s Server) ResponseTimeout() time.Duration {
+	return time.Duration(s.ResponseTimeoutMs) * time.Millisecond
+}
+
+func (s Server) HealthCheckInterval() time.Duration {
+	return time.Duration(s.HealthCheckIntervalSeconds) * time.Second
+}
+
+func (s *Server) validate(c *Config) []string {
+	var problems []string
+	if s.ResponseTimeoutMs <= 0 {
+		problems = append(problems, "RESPONSE_TIMEOUT_MS must be positive")
+	}
+	if s.ShutdownTimeoutSeconds <= 0 {
+		problems = append(problems, "SHUTDOWN_TIMEOUT_SECONDS must be positive")
+	}
+	return problems
+}
+
+// Auth configures checks of requests to dialogs, in addition to skill id check. Empty secret and key disable the checks.
+type Auth struct {
+	SecretHeader string `yaml:"secret_header" env:"AUTH_SECRET_HEADER" default:"X-Dialogs-Secret"`
+	SharedSecret string `yaml:"shared_secret" env:"AUTH_SHARED_SECRET" secret:"true"`
+	HMACHeader   string `yaml:"hmac_header" env:"AUTH_HMAC_HEADER" default:"X-Dialogs-Signature"`
+	HMACKey      string `yaml:"hmac_key" env:"AUTH_HMAC_KEY" secret:"true"`
+}
+
+// Logging configures levels of logging package, see its documentation.
+type Logging struct {
+	Level    string `yaml:"level" env:"LOG_LEVEL" default:"info"`
+	Levels   string `yaml:"levels" env:"LOG_LEVELS"`
+	UserText bool   `yaml:"user_text" env:"LOG_USER_TEXT"`
+}
+
+// Common is DB shared by dialogs. Sessions and statistics use it, if they have no own DB.
+type Common struct {
+	MongoConnection string `yaml:"mongo_connection" env:"COMMON_MONGO_CONNECTION" secret:"true"`
+	DatabaseName    string `yaml:"database_name" env:"COMMON_DATABASE_NAME" default:"common"`
+}
+
+type Sessions struct {
+	Store           string `yaml:"store" env:"SESSION_STORE" default:"memory"`
+	TTLMinutes      int64  `yaml:"ttl_minutes" env:"SESSION_TTL_MINUTES" default:"60"`
+	MongoConnection string `yaml:"mongo_connection" env:"SESSION_MONGO_CONNECTION" secret:"true"`
+	DatabaseName    string `yaml:"database_name" env:"SESSION_DATABASE_NAME"`
+}
+
+func (s Sessions) TTL() time.Duration {
+	return time.Duration(s.TTLMinutes) * time.Minute
+}
+
+func (s *Sessions) validate(c *Config) []string {
+	switch s.Store {
+	case "memory", "mongo", "alice", "alice_user":
+		return nil
+	}
+	return []string{"SESSION_STORE must be one of memory, mongo, alice or alice_user"}
+}
+
+type Statistics struct {
+	Token                string `yaml:"token" env:"STATISTICS_TOKEN" secret:"true"`
+	MongoConnection      string `yaml:"mongo_connection" env:"STATISTICS_MONGO_CONNECTION" secret:"true"`
+	DatabaseName         string `yaml:"database_name" env:"STATISTICS_DATABASE_NAME"`
+	FlushIntervalSeconds int64  `yaml:"flush_interval_seconds" env:"STATISTICS_FLUSH_INTERVAL" default:"60"`
+}
+
+func (s Statistics) FlushInterval() time.Duration {
+	return time.Duration(s.FlushIntervalSeconds) * time.Second
+}
+
+// Recorder configures recording of requests, see recorder package. Empty file disables recording.
+type Recorder struct {
+	File string `yaml:"file" env:"RECORD_FILE"`
+	Salt string `yaml:"salt" env:"RECORD_SALT" secret:"true"`
+	// KeepText records phrases of users and texts of responses as is, instead of hashes. Needed to replay recordings.
+	KeepText bool `yaml:"keep_text" env:"RECORD_TEXT"`
+}
+
+// Dialogs are sections of dialogs by name, which dialog is registered with.
+type Dialogs struct {
+	VoiceMail        VoiceMail        `yaml:"voice-mail"`
+	Masha            Masha            `yaml:"masha"`
+	Coronavirus      Coronavirus      `yaml:"coronavirus"`
+	Stalker          Stalker          `yaml:"stalker"`
+	PhrasesGenerator PhrasesGenerator `yaml:"phrases-generator"`
+	GoodMorning      GoodMorning      `yaml:"good-morning"`
+}
+
+type VoiceMail struct {
+	Enabled bool   `yaml:"enabled" env:"VOICE_MAIL_ENABLED" default:"true"`
+	SkillID string `yaml:"skill_id" env:"VOICE_MAIL_SKILL_ID"`
+	// `memory` keeps mail in process memory, for local runs without DB
+	Store           string `yaml:"store" env:"MAIL_STORE" default:"mongo"`
+	MongoConnection string `yaml:"mongo_connection" env:"MONGO_CONNECTION" secret:"true"`
+	DatabaseName    string `yaml:"database_name" env:"DATABASE_NAME" default:"voice-mail"`
+}
+
+func (v *VoiceMail) validate(c *Config) []string {
+	switch {
+	case v.Store == "memory":
+		return nil
+	case v.Store != "mongo":
+		return []string{"MAIL_STORE must be mongo or memory"}
+	case v.MongoConnection == "":
+		return []string{"MONGO_CONNECTION is required for mongo mail store"}
+	}
+	return nil
+}
+
+type Masha struct {
+	Enabled    bool   `yaml:"enabled" env:"MASHA_ENABLED" default:"true"`
+	SkillID    string `yaml:"skill_id" env:"MASHA_SKILL_ID"`
+	URL        string `yaml:"url" env:"MASHA_URL" required:"true"`
+	StupidMode bool   `yaml:"stupid_mode" env:"MASHA_STUPID_MODE"`
+	StupidURL  string `yaml:"stupid_url" env:"MASHA_STUPID_URL"`
+}
+
+func (m *Masha) validate(c *Config) []string {
+	if m.StupidMode && m.StupidURL == "" {
+		return []string{"MASHA_STUPID_URL is required in stupid mode"}
+	}
+	return nil
+}
+
+type Coronavirus struct {
+	Enabled       bool   `yaml:"enabled" env:"CORONAVIRUS_ENABLED" default:"true"`
+	SkillID       string `yaml:"skill_id" env:"CORONAVIRUS_SKILL_ID"`
+	API           string `yaml:"api" env:"CORONAVIRUS_API" required:"true"`
+	AdditionalAPI string `yaml:"additional_api" env:"CORONAVIRUS_ADDITIONAL_API"`
+}
+
+func (v *Coronavirus) validate(c *Config) []string {
+	return requireCommonDB(c)
+}
+
+type Stalker struct {
+	Enabled bool   `yaml:"enabled" env:"STALKER_ENABLED" default:"true"`
+	SkillID string `yaml:"skill_id" env:"STALKER_SKILL_ID"`
+}
+
+func (v *Stalker) validate(c *Config) []string {
+	return requireCommonDB(c)
+}
+
+type PhrasesGenerator struct {
+	Enabled bool   `yaml:"enabled" env:"PHRASES_GENERATOR_ENABLED" default:"true"`
+	SkillID string `yaml:"skill_id" env:"PHRASES_GENERATOR_SKILL_ID"`
+	URL     string `yaml:"url" env:"TITLE_GENERATOR_URL" required:"true"`
+}
+
+type GoodMorning struct {
+	Enabled bool   `yaml:"enabled" env:"GOOD_MORNING_ENABLED" default:"true"`
+	SkillID string `yaml:"skill_id" env:"GOOD_MORNING_SKILL_ID"`
+}
+
+func requireCommonDB(c *Config) []string {
+	if c.Common.MongoConnection == "" {
+		return []string{"COMMON_MONGO_CONNECTION is required"}
+	}
+	return nil
+}
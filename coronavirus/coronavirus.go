@@ -1,8 +1,8 @@
 package coronavirus
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/azzzak/alice"
 	"github.com/go-bongo/bongo"
@@ -10,7 +10,6 @@ import (
 	"github.com/robfig/cron/v3"
 	"gopkg.in/mgo.v2/bson"
 	"io/ioutil"
-	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -18,15 +17,27 @@ import (
 	"sync"
 	"time"
 	"yandex-dialogs/common"
+	"yandex-dialogs/fuzzy"
+	"yandex-dialogs/intents"
+	"yandex-dialogs/logging"
+	"yandex-dialogs/metrics"
+	"yandex-dialogs/registry"
+	"yandex-dialogs/reply"
+	"yandex-dialogs/statistics"
 )
 
-var mongoConnection = common.GetEnv("COMMON_MONGO_CONNECTION", "")
-var databaseName = common.GetEnv("COMMON_DATABASE_NAME", "common")
-var coronavirusApi = common.GetEnv("CORONAVIRUS_API", "")
-var coronavirusAddApi = common.GetEnv("CORONAVIRUS_ADDITIONAL_API", "")
+var logger = logging.For("coronavirus")
 
 var fullFirstPhrase = "На сегодняшний день в мире зафиксировано %d %s заражения коронавирусной инфекцией%s. \n%d %s умерли от болезни%s. \nВыздоровели - %d %s. \n\nОсновные очаги заражения: %s. \n\nВ России количество заразившихся достигло %d %s%s.\n"
 var epicentr = "Вот 20 стран с наибольшим количеством заразившихся: \n%s"
+
+// speakers without screen get short summary, long lists are hard to listen
+var shortFirstPhrase = "В мире зафиксировано %d %s заражения%s. \nВ России - %d%s.\n"
+
+// screen shows the first countries in card, so text names them and lists the rest under card
+var shortEpicentr = "Больше всего заразившихся в странах: %s. \n"
+var restEpicentr = "Далее идут: \n%s\n"
+var askCountry = "Назовите страну, чтобы узнать статистику по ней."
 var moreThanYesterday = ", это на %d больше, чем вчера"
 var moreThenDay = ", за сутки это число увеличилось на %d"
 var moreThanLastDay = ", их количество выросло на %d за последний день"
@@ -34,20 +45,51 @@ var moreThanLastDay = ", их количество выросло на %d за 
 var countryInfo = "В регионе \"%s\" было зафиксировано %d %s заражения%s. \n%d %s умерли от болезни%s. \nВыздоровели - %d %s%s."
 var countryInfoWithoutY = "В регионе \"%s\" было зафиксировано %d %s заражения. \n%d %s умерли от болезни. \nВыздоровели - %d %s."
 
-var funWords = []string{"когда", "эпидемия", "консерв"}
-var statsWords = []string{"статистик"}
-var sourcesWords = []string{"источник", "откуда", "данны"}
-var yesWord = "да"
-var yesterdayNews = []string{"вчера", "прошлы"}
-var epicentrWords = []string{"очаг", "самый", "самое"}
-var acceptNews = []string{"давай", "можно", "плюс", "ага", "угу", "новости", "что там в мире", "что в мире", "Да, давай новости", "давай новости"}
-var helpWords = []string{"помощь", "что ты може", "что ты умеешь"}
-var cancelWords = []string{"отмена", "хватит", "все", "всё", "закончи", "закончить", "выход", "выйди", "выйти"}
-var protectWords = []string{"защитить", "что делать", "не заболеть", "чеснок", "боротьс"}
-var symptomsWords = []string{"симптом"}
-var masksWords = []string{"маск", "респератор", "защита"}
-
-var runSkill = []string{"коронавирус", "хроник"}
+var funWords = []string{"когда", "эпидеми*", "консерв*"}
+var statsWords = []string{"статистик*"}
+var sourcesWords = []string{"источник*", "откуда", "данны*"}
+var yesWords = []string{"да"}
+var yesterdayNews = []string{"вчера*", "прошл*"}
+var epicentrWords = []string{"очаг*", "самый", "самое", "самые"}
+var acceptNews = []string{"давай*", "можно", "плюс", "ага", "угу", "новост*", "что там в мире", "что в мире"}
+var helpWords = []string{"помощь", "что ты може*", "что ты умеешь"}
+var cancelWords = []string{"отмена", "хватит", "все", "закончи", "закончить", "выход", "выйди", "выйти"}
+var protectWords = []string{"защитит*", "что делать", "не заболеть", "чеснок", "борот*"}
+var symptomsWords = []string{"симптом*"}
+var masksWords = []string{"маск*", "респиратор*", "респератор*", "защита"}
+
+var runSkill = []string{"коронавирус*", "хроник*"}
+
+const (
+	helpCommand      = "help"
+	sourcesCommand   = "sources"
+	yesterdayCommand = "yesterday_news"
+	epicentrCommand  = "epicentr"
+	newsCommand      = "news"
+	funCommand       = "fun"
+	cancelCommand    = "cancel"
+	symptomsCommand  = "symptoms"
+	protectCommand   = "protect"
+	masksCommand     = "masks"
+	statsCommand     = "stats"
+	runSkillCommand  = "run_skill"
+)
+
+var commands = intents.NewMatcher(
+	intents.Intent{Name: helpCommand, Phrases: helpWords, Priority: 100},
+	intents.Intent{Name: sourcesCommand, Phrases: sourcesWords, Priority: 90},
+	intents.Intent{Name: yesterdayCommand, Phrases: yesterdayNews, Priority: 80},
+	intents.Intent{Name: epicentrCommand, Phrases: epicentrWords, Priority: 70},
+	intents.Intent{Name: newsCommand, Phrases: yesWords, Priority: 60, Exact: true},
+	intents.Intent{Name: newsCommand, Phrases: acceptNews, Priority: 60},
+	intents.Intent{Name: funCommand, Phrases: funWords, Priority: 50},
+	intents.Intent{Name: cancelCommand, Phrases: cancelWords, Priority: 40},
+	intents.Intent{Name: symptomsCommand, Phrases: symptomsWords, Priority: 30},
+	intents.Intent{Name: protectCommand, Phrases: protectWords, Priority: 20},
+	intents.Intent{Name: masksCommand, Phrases: masksWords, Priority: 10},
+	intents.Intent{Name: statsCommand, Phrases: statsWords, Priority: 5},
+	intents.Intent{Name: runSkillCommand, Phrases: runSkill},
+)
 
 var runSkillPhrases = []string{"Здравствуйте!", "Приветствую!"}
 var endSkillPhrases = []string{"Удачи Вам, выживший! Постарайтесь сократить возможные контакты с зараженными и чаще мойте руки.", "Не хворайте, выживший! Постарайтесь сократить возможные контакты с зараженными и чаще мойте руки.", "Не болейте, выживший! Постарайтесь сократить возможные контакты с зараженными и чаще мойте руки."}
@@ -171,84 +213,106 @@ type User struct {
 }
 
 type Coronavirus struct {
-	backupStatus *DayStatus
-	mux          sync.Mutex
-	connection   *bongo.Connection
-	httpClient   http.Client
+	path          string
+	skillID       string
+	api           string
+	additionalApi string
+	backupStatus  *DayStatus
+	mux           sync.Mutex
+	connection    *bongo.Connection
+	mongo         *common.Connections
+	httpClient    *http.Client
+	cron          *cron.Cron
+}
+
+func (c *Coronavirus) ApiHandlers(router *mux.Router) {
+	// no implementation here
 }
 
-func (c Coronavirus) ApiHandlers(router *mux.Router) {
-	// no implementation here
+const defaultPath = "/api/dialogs/coronavirus"
+
+func init() {
+	registry.Register("coronavirus", defaultPath, func(path string, options registry.Options) (registry.Dialog, error) {
+		coronavirus := NewCoronavirus()
+		coronavirus.path = path
+		return coronavirus, nil
+	})
+}
+
+func NewCoronavirus() *Coronavirus {
+	return &Coronavirus{path: defaultPath}
 }
 
-func NewCoronavirus() Coronavirus {
+func (c *Coronavirus) Init(deps *common.Dependencies) error {
 	rand.Seed(time.Now().Unix())
-	config := &bongo.Config{
-		ConnectionString: mongoConnection,
-		Database:         databaseName,
-	}
-	connection, err := bongo.Connect(config)
+	connection, err := deps.Mongo.Get(deps.Config.Common.MongoConnection, deps.Config.Common.DatabaseName)
 	if err != nil {
-		log.Fatal(err)
-	}
-	connection.Session.SetPoolLimit(50)
-	coronavirus := Coronavirus{
-		connection: connection,
-		httpClient: http.Client{Timeout: time.Millisecond * 20000},
-	}
-	coronavirus.backupStatus = coronavirus.grabData()
-	c := cron.New()
-	c.AddFunc("*/5 * * * *", func() {
-		coronavirus.backupStatus = coronavirus.grabData()
+		return err
+	}
+	settings := deps.Config.Dialogs.Coronavirus
+	c.skillID = settings.SkillID
+	c.api = settings.API
+	c.additionalApi = settings.AdditionalAPI
+	c.connection = connection
+	c.mongo = deps.Mongo
+	c.httpClient = deps.UpstreamClient("coronavirus", 0)
+	c.setBackupStatus(c.grabData())
+
+	c.cron = cron.New()
+	c.cron.AddFunc("*/5 * * * *", func() {
+		defer metrics.ObserveCron("coronavirus_grab_data", time.Now())
+		c.setBackupStatus(c.grabData())
 	})
-	c.Start()
-	return coronavirus
+	c.cron.Start()
+	return nil
 }
 
-func (c Coronavirus) GetPath() string {
-	return "/api/dialogs/coronavirus"
+func (c *Coronavirus) Close(ctx context.Context) error {
+	return common.StopCron(ctx, c.cron)
 }
 
-func (c Coronavirus) Health() (result bool, message string) {
-	if c.Ping() != nil {
-		log.Printf("Ping failed")
-		c.Reconnect()
+func (c *Coronavirus) getBackupStatus() *DayStatus {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.backupStatus
+}
+
+func (c *Coronavirus) setBackupStatus(status *DayStatus) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.backupStatus = status
+}
+
+func (c *Coronavirus) GetPath() string {
+	return c.path
+}
+
+// PageSize is less than limit of Alice, long lists of news and countries are tiresome to listen.
+func (c *Coronavirus) PageSize() int {
+	return 600
+}
+
+func (c *Coronavirus) GetSkillID() string {
+	return c.skillID
+}
+
+func (c *Coronavirus) Health() (result bool, message string) {
+	if err := c.mongo.Ping(c.connection); err != nil {
+		logger.Warnf("Ping of DB failed: %v", err)
 		return false, "DB is not available"
 	}
 	return true, "OK"
 }
 
-func (c Coronavirus) Reconnect() {
-	err := c.connection.Connect()
-	if err != nil {
-		log.Print(err)
+func (c *Coronavirus) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	h := c.HandleRequestContext()
+	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		return h(context.Background(), request, response)
 	}
-	c.connection.Session.SetPoolLimit(50)
 }
 
-func (c Coronavirus) Ping() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Print("Recovered in f", r)
-			err = errors.New("Error ping")
-		}
-	}()
-	err = c.connection.Session.Ping()
-	return err
-}
-
-func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
-	return func(request *alice.Request, response *alice.Response) (resp *alice.Response) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Print("Recovered in f: ", r)
-				response.Text("Произошла ошибка, попробуйте в другой раз")
-				response.Button("Закончить", "", true)
-				resp = response
-			}
-		}()
-		c.Health()
-
+func (c *Coronavirus) HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
 		currentStatus := c.GetDayStatus()
 		user := c.GetUser(request.UserID())
 		if user == nil {
@@ -263,7 +327,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 		text := ""
 
 		if currentStatus == nil {
-			currentStatus = c.backupStatus
+			currentStatus = c.getBackupStatus()
 			if currentStatus == nil {
 				response.Text("В работе навыка произошли проблемы, пожалуйста, попробуй позже. Приносим извинения за неудобства.")
 				response.Button("Выйти", "", true)
@@ -276,7 +340,10 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			text += "\n"
 		}
 
-		if containsIgnoreCase(request.Text(), helpWords) {
+		command := commands.Match(request.Text())
+		statistics.ReportCommand(ctx, command.Name)
+
+		if command.Name == helpCommand {
 			response.Text("Это твой личный гид в хроники коронавируса. Полезный навык, который помогает быть всегда в курсе текущей ситуации с коронавирусом в России и мире. " +
 				"\nВы можете спросить навык о статистике заболевания по регионам, узнать про очаги заражения, а также прослушать важные новости." +
 				"\nМожешь спросить о симптомах коронавируса или о том, как от него защититься." +
@@ -293,7 +360,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), sourcesWords) {
+		if command.Name == sourcesCommand {
 			response.Text("Навык использует несколько источников для формирования статистики. Это данные Johns Hopkins University, Роспотребнадзора и сайта Coronavirus Monitor.")
 			response.Button("JHU мониторинг", "https://www.arcgis.com/apps/opsdashboard/index.html#/bda7594740fd40299423467b48e9ecf6", false)
 			response.Button("Роспотребнадзор", "https://www.rospotrebnadzor.ru/", false)
@@ -305,7 +372,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), yesterdayNews) {
+		if command.Name == yesterdayCommand {
 			text += buildNews(currentStatus.Yesterday.AllNews)
 			response.Text(text)
 			response.Button("Актуальные новости", "", true)
@@ -315,17 +382,39 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), epicentrWords) {
-			text += fmt.Sprintf(epicentr, c.printFire(currentStatus))
+		// speaker reads the whole list, it is paginated by pager
+		if command.Name == epicentrCommand && !common.HasScreen(request) {
+			text += fmt.Sprintf(epicentr, printFire(c.fireItems(currentStatus)))
 			response.Text(text)
 			response.Button("Актуальные новости", "", true)
+			response.Button("Выйти", "", true)
+			return response
+		}
+
+		// screen shows the first countries in card and the rest in text, as card can not be paginated
+		if command.Name == epicentrCommand {
+			items := c.fireItems(currentStatus)
+			shown := len(items)
+			if shown > reply.MaxListItems {
+				shown = reply.MaxListItems
+			}
+			text += fmt.Sprintf(shortEpicentr, c.printFireNames(currentStatus))
+			if shown < len(items) {
+				text += fmt.Sprintf(restEpicentr, printFire(items[shown:]))
+			}
+			text += askCountry
+			reply.New(response).
+				Text(text).
+				ItemsList("Больше всего заразившихся", items[:shown], "").
+				Build()
+			response.Button("Актуальные новости", "", true)
 			response.Button("Симптомы", "", true)
 			response.Button("Как защититься", "", true)
 			response.Button("Выйти", "", true)
 			return response
 		}
 
-		if strings.EqualFold(request.Text(), yesWord) || containsIgnoreCase(request.Text(), acceptNews) {
+		if command.Name == newsCommand {
 			text += buildNews(currentStatus.Current.AllNews)
 			response.Text(text)
 			response.Button("Вчерашние новости", "", true)
@@ -337,7 +426,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), funWords) {
+		if command.Name == funCommand {
 			text += "В мире объявлена пандемия коронавируса, полки магазинов пустеют, людям рекомендуют работать из дома..."
 			response.Text(text)
 			response.Button("Хроники коронавируса", "", true)
@@ -347,7 +436,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), cancelWords) {
+		if command.Name == cancelCommand {
 			text := endSkillPhrases[rand.Intn(len(endSkillPhrases))]
 			response.Text(text + "\nСкажи - закончить, чтобы я отключился.")
 			response.Button("Оценить навык", "https://dialogs.yandex.ru/store/skills/d5087c0d-hroniki-koronavirusa", false)
@@ -355,7 +444,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), symptomsWords) {
+		if command.Name == symptomsCommand {
 			text += symptomsPhrases[rand.Intn(len(symptomsPhrases))]
 			response.Text(text)
 			response.Button("Новости", "", true)
@@ -366,7 +455,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), protectWords) {
+		if command.Name == protectCommand {
 			text += howToProtectPhrases[rand.Intn(len(howToProtectPhrases))]
 			response.Text(text)
 			response.Button("Новости", "", true)
@@ -376,7 +465,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), masksWords) {
+		if command.Name == masksCommand {
 			text += masksPhrases[rand.Intn(len(masksPhrases))]
 			response.Text(text)
 			response.Button("Новости", "", true)
@@ -387,18 +476,21 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), statsWords) {
-			text += "Назовите или выберите страну или город, для которого хотите услышать статистику по заражениям"
-			response.Text(text)
-			response.Button("Россия", "", true)
-			response.Button("Украина", "", true)
-			response.Button("Беларусь", "", true)
-			response.Button("Москва", "", true)
-			response.Button("Выйти", "", true)
-			return response
+		if command.Name == statsCommand {
+			// if region is mentioned together with statistics, region statistics is printed below
+			if hasReg, _ := hasRegion(*request); !hasReg {
+				text += "Назовите или выберите страну или город, для которого хотите услышать статистику по заражениям"
+				response.Text(text)
+				response.Button("Россия", "", true)
+				response.Button("Украина", "", true)
+				response.Button("Беларусь", "", true)
+				response.Button("Москва", "", true)
+				response.Button("Выйти", "", true)
+				return response
+			}
 		}
 
-		if len(request.Text()) > 3 && !containsIgnoreCase(request.Text(), runSkill) {
+		if len(request.Text()) > 3 && command.Name != runSkillCommand {
 			var regName string
 			hasReg, region := hasRegion(*request)
 			if hasReg {
@@ -438,7 +530,7 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 				} else {
 					text += fmt.Sprintf(countryInfoWithoutY, curRegInfo.Ru, curRegInfo.Confirmed, Plural(curRegInfo.Confirmed, "случай", "случая", "случаев"), curRegInfo.Deaths, Plural(curRegInfo.Deaths, "человек", "человека", "человек"), curRegInfo.Cured, Plural(curRegInfo.Cured, "человек", "человека", "человек"))
 				}
-				if curRegInfo.Ru == "Россия" {
+				if curRegInfo.Ru == "Россия" && common.HasScreen(request) {
 					text += fmt.Sprintf("\n\nКоронавирус был зафиксирован в %d %s страны. \nВот 10 регионов, с наибольшим количеством заразившихся: \n%s\nПроизнесите название города или области, чтобы узнать статистику по этому региону.", len(currentStatus.Current.Cities), Plural(len(currentStatus.Current.Cities), "регионе", "регионах", "регионах"), c.printFireCities(currentStatus))
 				}
 				response.Text(text)
@@ -475,13 +567,20 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 		if curRusReg.Confirmed-yesRusReg.Confirmed > 0 {
 			rusConfirmedTemplate = fmt.Sprintf(moreThanYesterday, curRusReg.Confirmed-yesRusReg.Confirmed)
 		}
-		text += fmt.Sprintf(fullFirstPhrase,
-			currentStatus.Current.Confirmed, Plural(currentStatus.Current.Confirmed, "случай", "случая", "случаев"), confirmedTemplate,
-			currentStatus.Current.Deaths, Plural(currentStatus.Current.Deaths, "человек", "человека", "человек"), deathTemplate,
-			currentStatus.Current.Cured, Plural(currentStatus.Current.Cured, "человек", "человека", "человек"),
-			c.printFireNames(currentStatus),
-			curRusReg.Confirmed, Plural(curRusReg.Confirmed, "человек", "человека", "человек"), rusConfirmedTemplate,
-		)
+		if common.HasScreen(request) {
+			text += fmt.Sprintf(fullFirstPhrase,
+				currentStatus.Current.Confirmed, Plural(currentStatus.Current.Confirmed, "случай", "случая", "случаев"), confirmedTemplate,
+				currentStatus.Current.Deaths, Plural(currentStatus.Current.Deaths, "человек", "человека", "человек"), deathTemplate,
+				currentStatus.Current.Cured, Plural(currentStatus.Current.Cured, "человек", "человека", "человек"),
+				c.printFireNames(currentStatus),
+				curRusReg.Confirmed, Plural(curRusReg.Confirmed, "человек", "человека", "человек"), rusConfirmedTemplate,
+			)
+		} else {
+			text += fmt.Sprintf(shortFirstPhrase,
+				currentStatus.Current.Confirmed, Plural(currentStatus.Current.Confirmed, "случай", "случая", "случаев"), confirmedTemplate,
+				curRusReg.Confirmed, rusConfirmedTemplate,
+			)
+		}
 		text += "\n"
 		if user.Count == 1 {
 			text += firstHi
@@ -500,8 +599,9 @@ func (c Coronavirus) HandleRequest() func(request *alice.Request, response *alic
 	}
 }
 
-func (c Coronavirus) GetDayStatus() *DayStatus {
+func (c *Coronavirus) GetDayStatus() *DayStatus {
 	status := &DayStatus{}
+	defer metrics.ObserveMongo("coronavirus", "find", time.Now())
 	err := c.connection.Collection("coronavirus").FindOne(bson.M{}, status)
 	if err != nil {
 		return nil
@@ -509,8 +609,9 @@ func (c Coronavirus) GetDayStatus() *DayStatus {
 	return status
 }
 
-func (c Coronavirus) GetUser(id string) *User {
+func (c *Coronavirus) GetUser(id string) *User {
 	user := &User{}
+	defer metrics.ObserveMongo("users", "find", time.Now())
 	err := c.connection.Collection("users").FindOne(bson.M{"id": id}, user)
 	if err != nil {
 		return nil
@@ -518,15 +619,6 @@ func (c Coronavirus) GetUser(id string) *User {
 	return user
 }
 
-func containsIgnoreCase(message string, wordsToCheck []string) bool {
-	for _, word := range wordsToCheck {
-		if strings.Contains(strings.ToUpper(message), strings.ToUpper(word)) {
-			return true
-		}
-	}
-	return false
-}
-
 func buildNews(news []New) string {
 	strNew := ""
 	for _, news_item := range news {
@@ -546,6 +638,15 @@ func findRegion(regions []Region, cities []Region, reg string) *Region {
 			return &region
 		}
 	}
+	// speech recognition can misspell region name
+	all := append(append([]Region{}, regions...), cities...)
+	names := make([]string, len(all))
+	for i, region := range all {
+		names[i] = region.Ru
+	}
+	if i, ok := fuzzy.Closest(reg, names); ok {
+		return &all[i]
+	}
 	return nil
 }
 
@@ -561,7 +662,7 @@ func hasRegion(request alice.Request) (bool, *string) {
 				//}
 				err := json.Unmarshal(*entity.Value, &value)
 				if err != nil {
-					log.Printf("Cannot unmarshal GEO command for request: %v", request.Text())
+					logger.Warnf("Cannot unmarshal GEO command for request: %v", logging.Text(request.Text()))
 					return false, nil
 				}
 				if country, ok := value["country"]; ok {
@@ -595,14 +696,15 @@ func Plural(n int, singular, plural1, plural2 string) string {
 	}
 }
 
-func (c Coronavirus) saveUser(user *User) {
+func (c *Coronavirus) saveUser(user *User) {
+	defer metrics.ObserveMongo("users", "save", time.Now())
 	err := c.connection.Collection("users").Save(user)
 	if err != nil {
-		log.Print("Error when saving to DB")
+		logger.Errorf("Error when saving to DB: %v", err)
 	}
 }
 
-func (c Coronavirus) printFireNames(dayStatus *DayStatus) string {
+func (c *Coronavirus) printFireNames(dayStatus *DayStatus) string {
 	strFire := make([]string, 0)
 	for i := 0; i < 5; i++ {
 		curInf := dayStatus.Current.Countries[i]
@@ -611,24 +713,34 @@ func (c Coronavirus) printFireNames(dayStatus *DayStatus) string {
 	return strings.Join(strFire, ", ")
 }
 
-func (c Coronavirus) printFire(dayStatus *DayStatus) string {
+// printFire returns countries of items with numbers of cases, a line per country.
+func printFire(items []reply.Item) string {
 	strFire := make([]string, 0)
-	for i := 0; i < 20; i++ {
+	for _, item := range items {
+		strFire = append(strFire, item.Title+" - "+item.Description)
+	}
+	return strings.Join(strFire, "\n")
+}
+
+// fireItems returns 20 countries with the most confirmed cases, with number of cases in description.
+func (c *Coronavirus) fireItems(dayStatus *DayStatus) []reply.Item {
+	items := make([]reply.Item, 0)
+	for i := 0; i < 20 && i < len(dayStatus.Current.Countries); i++ {
 		curInf := dayStatus.Current.Countries[i]
 		yesInf := findRegion(dayStatus.Yesterday.Countries, dayStatus.Yesterday.Cities, curInf.Ru)
 		if yesInf == nil {
 			yesInf = &curInf
 		}
-		str := fmt.Sprintf("%s - %d %s", curInf.Ru, curInf.Confirmed, Plural(curInf.Confirmed, "человек", "человека", "человек"))
+		str := fmt.Sprintf("%d %s", curInf.Confirmed, Plural(curInf.Confirmed, "человек", "человека", "человек"))
 		if curInf.Confirmed-yesInf.Confirmed > 0 {
 			str += fmt.Sprintf(" (+%d за день)", curInf.Confirmed-yesInf.Confirmed)
 		}
-		strFire = append(strFire, str)
+		items = append(items, reply.Item{Title: curInf.Ru, Description: str})
 	}
-	return strings.Join(strFire, "\n")
+	return items
 }
 
-func (c Coronavirus) printFireCities(dayStatus *DayStatus) string {
+func (c *Coronavirus) printFireCities(dayStatus *DayStatus) string {
 	strFire := make([]string, 0)
 	for i := 0; i < 10; i++ {
 		city := dayStatus.Current.Cities[i]
@@ -645,18 +757,18 @@ func (c Coronavirus) printFireCities(dayStatus *DayStatus) string {
 	return strings.Join(strFire, "\n")
 }
 
-func (c Coronavirus) grabData() *DayStatus {
+func (c *Coronavirus) grabData() *DayStatus {
 	currentStatus := c.GetDayStatus()
-	resp, err := c.httpClient.Get(coronavirusApi)
+	resp, err := c.httpClient.Get(c.api)
 	if err != nil {
-		log.Print("Error: when getting coronavirus response")
+		logger.Errorf("Error: when getting coronavirus response: %v", err)
 		return currentStatus
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Print("Error: when reading coronavirus response")
+		logger.Errorf("Error: when reading coronavirus response: %v", err)
 		return currentStatus
 	}
 
@@ -667,7 +779,7 @@ func (c Coronavirus) grabData() *DayStatus {
 	var result Response
 	err = json.Unmarshal(bodyBytes, &result)
 	if err != nil {
-		log.Print("Error: when unmarhsal coronavirus response")
+		logger.Errorf("Error: when unmarhsal coronavirus response: %v", err)
 		return currentStatus
 	}
 
@@ -709,32 +821,34 @@ func (c Coronavirus) grabData() *DayStatus {
 		}
 	}
 
+	start := time.Now()
 	err = c.connection.Collection("coronavirus").Save(currentStatus)
+	metrics.ObserveMongo("coronavirus", "save", start)
 	if err != nil {
-		log.Print("Error when saving to DB")
+		logger.Errorf("Error when saving to DB: %v", err)
 	}
-	log.Print("New info saved")
+	logger.Infof("New info saved")
 	return currentStatus
 }
 
-func (c Coronavirus) enrichCoronaInfo(info CoronavirusInfo, status *DayStatus) CoronavirusInfo {
-	addResp, err := c.httpClient.Get(coronavirusAddApi + "/all")
+func (c *Coronavirus) enrichCoronaInfo(info CoronavirusInfo, status *DayStatus) CoronavirusInfo {
+	addResp, err := c.httpClient.Get(c.additionalApi + "/all")
 	if err != nil {
-		log.Print("Error: when getting additional coronavirus response")
+		logger.Errorf("Error: when getting additional coronavirus response: %v", err)
 		return info
 	}
 	defer addResp.Body.Close()
 
 	bodyBytes, err := ioutil.ReadAll(addResp.Body)
 	if err != nil {
-		log.Print("Error: when reading additional coronavirus response")
+		logger.Errorf("Error: when reading additional coronavirus response: %v", err)
 		return info
 	}
 
 	var result AddResponse
 	err = json.Unmarshal(bodyBytes, &result)
 	if err != nil {
-		log.Print("Error: when unmarhsal additional coronavirus response")
+		logger.Errorf("Error: when unmarhsal additional coronavirus response: %v", err)
 		return info
 	}
 
@@ -748,23 +862,23 @@ func (c Coronavirus) enrichCoronaInfo(info CoronavirusInfo, status *DayStatus) C
 		info.Cured = result.Recovered
 	}
 
-	addResp, err = c.httpClient.Get(coronavirusAddApi + "/countries/russia")
+	addResp, err = c.httpClient.Get(c.additionalApi + "/countries/russia")
 	if err != nil {
-		log.Print("Error: when getting additional coronavirus response")
+		logger.Errorf("Error: when getting additional coronavirus response: %v", err)
 		return info
 	}
 	defer addResp.Body.Close()
 
 	bodyBytes, err = ioutil.ReadAll(addResp.Body)
 	if err != nil {
-		log.Print("Error: when reading additional coronavirus response")
+		logger.Errorf("Error: when reading additional coronavirus response: %v", err)
 		return info
 	}
 
 	var rusResult AddResponse
 	err = json.Unmarshal(bodyBytes, &rusResult)
 	if err != nil {
-		log.Print("Error: when unmarhsal additional coronavirus response")
+		logger.Errorf("Error: when unmarhsal additional coronavirus response: %v", err)
 		return info
 	}
 
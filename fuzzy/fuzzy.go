@@ -0,0 +1,127 @@
+package fuzzy
+
+import (
+	"github.com/agnivade/levenshtein"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Normalize lower-cases text, trims it and replaces "ё" with "е", as speech recognition uses them interchangeably.
+func Normalize(text string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(text)), "ё", "е")
+}
+
+// MaxDistance returns number of letter mistakes allowed for word of given length.
+// Short words are compared strictly: "да" and "не" differ from "до" and "но" in only one letter.
+func MaxDistance(length int) int {
+	switch {
+	case length <= 4:
+		return 0
+	case length <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Distance returns edit distance between normalized texts in letters.
+func Distance(a, b string) int {
+	return levenshtein.ComputeDistance(Normalize(a), Normalize(b))
+}
+
+// Equal reports whether texts are equal up to recognition mistakes.
+func Equal(a, b string) bool {
+	a, b = Normalize(a), Normalize(b)
+	if a == b {
+		return true
+	}
+	return levenshtein.ComputeDistance(a, b) <= MaxDistance(minLength(a, b))
+}
+
+// HasPrefix reports whether word starts with stem up to recognition mistakes.
+func HasPrefix(word, stem string) bool {
+	word, stem = Normalize(word), Normalize(stem)
+	if strings.HasPrefix(word, stem) {
+		return true
+	}
+	length := utf8.RuneCountInString(stem)
+	runes := []rune(word)
+	if len(runes) < length-1 {
+		return false
+	}
+	// recognition may add or lose a letter, so prefixes of neighbour lengths are checked too
+	for _, l := range []int{length - 1, length, length + 1} {
+		if l > 0 && l <= len(runes) && levenshtein.ComputeDistance(string(runes[:l]), stem) <= MaxDistance(length) {
+			return true
+		}
+	}
+	return false
+}
+
+// Closest returns index of candidate closest to text. Text and candidates are compared word by word, and words may differ
+// in endings, so that inflected names like "московской области" are found among names like "Московская область".
+// Returns false if there is no candidate with the same number of words, each within allowed distance.
+func Closest(text string, candidates []string) (int, bool) {
+	words := splitWords(text)
+	best, bestDistance := -1, 0
+	for i, candidate := range candidates {
+		distance, ok := wordsDistance(words, splitWords(candidate))
+		if !ok {
+			continue
+		}
+		if best == -1 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return best, best != -1
+}
+
+// splitWords returns normalized words of text. Hyphenated words, like "санкт-петербург", are split too.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(Normalize(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordsDistance returns sum of distances between words of a and b. Words are matched by stems, see stem, but whole
+// words are measured, so that exact form of word is closer than inflected one. Returns false if a and b have different
+// number of words or any pair of stems differs more than allowed.
+func wordsDistance(a, b []string) (int, bool) {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0, false
+	}
+	total := 0
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		stemA, stemB := stem(a[i]), stem(b[i])
+		if levenshtein.ComputeDistance(stemA, stemB) > MaxDistance(minLength(stemA, stemB)) {
+			return 0, false
+		}
+		total += levenshtein.ComputeDistance(a[i], b[i])
+	}
+	return total, true
+}
+
+// endings are letters of endings of inflected Russian words, like "ой" of "московской" or "ом" of "краснодарском".
+const endings = "аеиоуыэюяйьмх"
+
+// stem drops up to 3 letters of ending of normalized word, keeping at least 2 letters.
+func stem(word string) string {
+	runes := []rune(word)
+	end := len(runes)
+	for end > 2 && len(runes)-end < 3 && strings.ContainsRune(endings, runes[end-1]) {
+		end--
+	}
+	return string(runes[:end])
+}
+
+func minLength(a, b string) int {
+	la, lb := utf8.RuneCountInString(a), utf8.RuneCountInString(b)
+	if la < lb {
+		return la
+	}
+	return lb
+}
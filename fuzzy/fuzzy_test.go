@@ -0,0 +1,87 @@
+package fuzzy
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Привет", " привет ", true},
+		{"ёлка", "елка", true},
+		{"да", "до", false},
+		{"не", "нет", false},
+		{"отмена", "атмена", true},
+		{"отмена", "отменна", true},
+		{"отмена", "омена", true},
+		{"отмена", "амена", false},
+		{"сообщение", "сабщение", true},
+		{"сообщение", "собщенние", true},
+		{"сообщение", "прощение", false},
+	}
+	for _, test := range tests {
+		if got := Equal(test.a, test.b); got != test.want {
+			t.Errorf("Equal(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	tests := []struct {
+		word, stem string
+		want       bool
+	}{
+		{"токены", "токен", true},
+		{"такен", "токен", true},
+		{"токинг", "токен", true},
+		{"ток", "токен", false},
+		{"тонкий", "токен", false},
+		{"повтори", "повтор", true},
+		{"поаторить", "повтор", true},
+		{"отмени", "отмен", true},
+		{"знакомство", "знаком", true},
+		{"знак", "знаком", false},
+	}
+	for _, test := range tests {
+		if got := HasPrefix(test.word, test.stem); got != test.want {
+			t.Errorf("HasPrefix(%q, %q) = %v, want %v", test.word, test.stem, got, test.want)
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	regions := []string{"Москва", "Московская область", "Санкт-Петербург", "Ленинградская область", "Краснодарский край", "Республика Крым"}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"москва", 0},
+		{"в москве", -1},
+		{"москве", 0},
+		{"масква", 0},
+		{"московской области", 1},
+		{"московская область", 1},
+		{"масковская область", 1},
+		{"санкт петербурге", 2},
+		{"санкт-петербург", 2},
+		{"ленинградской области", 3},
+		{"краснодарском крае", 4},
+		{"крым", -1},
+		{"республике крым", 5},
+		{"область", -1},
+		{"", -1},
+	}
+	for _, test := range tests {
+		i, ok := Closest(test.text, regions)
+		if ok != (test.want != -1) || i != test.want {
+			t.Errorf("Closest(%q) = %d, %v, want %d", test.text, i, ok, test.want)
+		}
+	}
+
+	names := []string{"САША", "МАША", "МАМА"}
+	for text, want := range map[string]int{"саша": 0, "саше": 0, "машу": 1, "маме": 2, "миша": -1} {
+		if i, ok := Closest(text, names); ok != (want != -1) || i != want {
+			t.Errorf("Closest(%q) = %d, %v, want %d", text, i, ok, want)
+		}
+	}
+}
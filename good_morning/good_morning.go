@@ -1,19 +1,147 @@
 package good_morning
 
 import (
+	"context"
+	"fmt"
 	"github.com/azzzak/alice"
+	"github.com/gorilla/mux"
+	"math/rand"
+	"time"
+	"yandex-dialogs/common"
+	"yandex-dialogs/intents"
+	"yandex-dialogs/registry"
+	"yandex-dialogs/statistics"
 )
 
-type GoodMorning struct{}
+var weekdays = [...]string{"воскресенье", "понедельник", "вторник", "среду", "четверг", "пятницу", "субботу"}
 
-func (GoodMorning) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
-	panic("implement me")
+var wishes = [...]string{
+	"Пусть этот день будет лёгким, а кофе - крепким!",
+	"Желаю, чтобы все дела сегодня получались с первого раза.",
+	"Улыбнитесь! Сегодня обязательно случится что-то хорошее.",
+	"Пусть сегодня будет повод для радости, и не один.",
+	"Хорошего настроения и приятных встреч!",
+	"Пусть день будет солнечным, даже если за окном дождь.",
+	"Желаю бодрости, вдохновения и свободного вечера.",
 }
 
-func (GoodMorning) GetPath() string {
-	panic("implement me")
+var moreWords = []string{"ещё", "еще", "дальше", "давай", "другое", "пожелай*", "пожелание"}
+var exitWords = []string{"отмена", "хватит", "выйти", "закончи*", "закрыть", "выход", "спасибо"}
+var exitExactWords = []string{"все", "нет"}
+var helpWords = []string{"ты умеешь", "ты можешь"}
+var helpExactWords = []string{"помощь"}
+
+const (
+	moreCommand = "more"
+	exitCommand = "exit"
+	helpCommand = "help"
+)
+
+var commands = intents.NewMatcher(
+	intents.Intent{Name: exitCommand, Phrases: exitWords, Priority: 20},
+	intents.Intent{Name: exitCommand, Phrases: exitExactWords, Priority: 20, Exact: true},
+	intents.Intent{Name: helpCommand, Phrases: helpWords, Priority: 10},
+	intents.Intent{Name: helpCommand, Phrases: helpExactWords, Priority: 10, Exact: true},
+	intents.Intent{Name: moreCommand, Phrases: moreWords},
+)
+
+// GoodMorning greets user with good morning and wishes for the day.
+type GoodMorning struct {
+	path    string
+	skillID string
+	now     func() time.Time
+}
+
+const defaultPath = "/api/dialogs/good-morning"
+
+func init() {
+	registry.Register("good-morning", defaultPath, func(path string, options registry.Options) (registry.Dialog, error) {
+		goodMorning := NewGoodMorning()
+		goodMorning.path = path
+		return goodMorning, nil
+	})
 }
 
-func (GoodMorning) Health() (result bool, message string) {
-	panic("implement me")
+func NewGoodMorning() *GoodMorning {
+	return &GoodMorning{path: defaultPath, now: time.Now}
+}
+
+func (g *GoodMorning) Init(deps *common.Dependencies) error {
+	g.skillID = deps.Config.Dialogs.GoodMorning.SkillID
+	return nil
+}
+
+func (g *GoodMorning) Close(ctx context.Context) error {
+	return nil
+}
+
+func (g *GoodMorning) GetPath() string {
+	return g.path
+}
+
+func (g *GoodMorning) GetSkillID() string {
+	return g.skillID
+}
+
+func (g *GoodMorning) Health() (result bool, message string) {
+	return true, "OK"
+}
+
+func (g *GoodMorning) ApiHandlers(router *mux.Router) {
+	// no implementation here
+}
+
+func (g *GoodMorning) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	h := g.HandleRequestContext()
+	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		return h(context.Background(), request, response)
+	}
+}
+
+func (g *GoodMorning) HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+		command := commands.Match(request.Text())
+		statistics.ReportCommand(ctx, command.Name)
+		if request.Session.New {
+			response.Text(fmt.Sprintf("%s! Сегодня %s. %s", g.greeting(), weekdays[g.now().In(moscow).Weekday()], randomWish()))
+			response.Button("Ещё пожелание", "", true)
+			response.Button("Закончить", "", true)
+			return response
+		}
+		switch command.Name {
+		case exitCommand:
+			response.Text("Хорошего дня!")
+			response.Response.EndSession = true
+		case helpCommand:
+			response.Text("Я желаю доброго утра и хорошего дня. Скажите - ещё, и я пожелаю что-нибудь ещё, или - хватит, чтобы закончить.")
+			response.Button("Ещё пожелание", "", true)
+			response.Button("Закончить", "", true)
+		default:
+			response.Text(randomWish())
+			response.Button("Ещё пожелание", "", true)
+			response.Button("Закончить", "", true)
+		}
+		return response
+	}
+}
+
+// greeting returns greeting for time of day in Moscow, where most users are.
+func (g *GoodMorning) greeting() string {
+	hour := g.now().In(moscow).Hour()
+	switch {
+	case hour >= 5 && hour < 12:
+		return "Доброе утро"
+	case hour >= 12 && hour < 18:
+		return "Добрый день, хоть утро уже и прошло"
+	case hour >= 18 && hour < 23:
+		return "Добрый вечер, но доброе утро будет завтра"
+	default:
+		return "Доброй ночи, до утра ещё далеко"
+	}
+}
+
+var moscow = time.FixedZone("MSK", 3*60*60)
+
+func randomWish() string {
+	return wishes[rand.Intn(len(wishes))]
 }
@@ -0,0 +1,21 @@
+package good_morning
+
+import (
+	"testing"
+	"time"
+	"yandex-dialogs/harness"
+)
+
+func TestConversation(t *testing.T) {
+	dialog := NewGoodMorning()
+	// Monday, 8 am in Moscow
+	dialog.now = func() time.Time {
+		return time.Date(2020, 4, 6, 5, 0, 0, 0, time.UTC)
+	}
+	harness.NewConversation(t, dialog, "user").Run(
+		harness.Step{Say: "", Text: []string{"Доброе утро!", "Сегодня понедельник."}, Buttons: []string{"Ещё пожелание", "Закончить"}},
+		harness.Step{Say: "ещё пожелание", Buttons: []string{"Ещё пожелание", "Закончить"}},
+		harness.Step{Say: "помощь", Text: []string{"Я желаю доброго утра"}},
+		harness.Step{Say: "хватит", Text: []string{"Хорошего дня!"}, EndSession: true},
+	)
+}
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/azzzak/alice"
-	"log"
+	"github.com/gorilla/mux"
+	"io/ioutil"
 	"net/http"
+	runtimedebug "runtime/debug"
+	"strings"
 	"sync"
+	"time"
+	"yandex-dialogs/auth"
 	"yandex-dialogs/common"
+	"yandex-dialogs/health"
+	"yandex-dialogs/logging"
+	"yandex-dialogs/metrics"
+	"yandex-dialogs/nlu"
+	"yandex-dialogs/recorder"
+	"yandex-dialogs/reply"
+	"yandex-dialogs/statistics"
 )
 
-var statistics = map[string]map[string]int{}
-
-var debug = common.GetEnv("DEBUG_LOG", "false")
-
 func JsonContentType(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -20,7 +31,16 @@ func JsonContentType(h http.Handler) http.Handler {
 	})
 }
 
-func handleRequest(f func(request *alice.Request, response *alice.Response) *alice.Response) func(w http.ResponseWriter, r *http.Request) {
+// handleRequest handles requests to dialog. Long responses are split into pages by pager, nil pager cuts them to limits.
+// Requests and responses are written to rec, nil rec disables recording.
+func handleRequest(dialog Dialog, pager *reply.Pager, authenticator auth.Authenticator, stats *statistics.Aggregator, rec *recorder.Recorder) func(w http.ResponseWriter, r *http.Request) {
+	path := dialog.GetPath()
+	f := contextHandler(dialog)
+	intentHandlers := map[string]nlu.Handler{}
+	if intentDialog, ok := dialog.(IntentDialog); ok {
+		intentHandlers = intentDialog.IntentHandlers()
+	}
+
 	reqPool := sync.Pool{
 		New: func() interface{} {
 			return new(alice.Request)
@@ -42,102 +62,300 @@ func handleRequest(f func(request *alice.Request, response *alice.Response) *ali
 			w.Write([]byte("Ok"))
 			return
 		}
+		start := time.Now()
+		requestLogger := logger.With("dialog", path).With("request_id", requestID(w, r))
 		req := reqPool.Get().(*alice.Request)
 		defer reqPool.Put(req)
 
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(req); err != nil {
-			log.Println(err)
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			requestLogger.Warnf("Cannot read request: %v", err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		resp := initResponse(respPool, req)
+		// pooled request keeps fields missing in body, like skill id checked by authenticator or screen of previous device
+		*req = alice.Request{}
+		if err := json.Unmarshal(body, req); err != nil {
+			requestLogger.Warnf("Cannot parse request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requestLogger = requestLogger.
+			With("session_id", req.Session.SessionID).
+			With("message_id", req.Session.MessageID).
+			With("user", logging.ID(req.Session.UserID))
+		if err := authenticator.Authenticate(r, body, req); err != nil {
+			requestLogger.Warnf("Rejected request from host %s: %v", r.RemoteAddr, err)
+			auth.Rejections.Inc(path)
+			metrics.AuthRejections.Inc(path, auth.ReasonOf(err))
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"Forbidden: request is not authenticated for this skill"}`))
+			return
+		}
+		stateRequest := &common.StateRequest{}
+		if err := json.Unmarshal(body, stateRequest); err != nil {
+			requestLogger.Warnf("Cannot read state of request: %v", err)
+		}
+		state := common.NewRequestState(stateRequest)
+
+		fallback := initResponse(&respPool, req)
+		resp := fallback
+		// response of dialog late to respond is not put back, as dialog may still write it
+		defer func() {
+			respPool.Put(fallback)
+			if resp != nil && resp != fallback {
+				respPool.Put(resp)
+			}
+		}()
 		if req.Request.OriginalUtterance != "ping" {
-			resp = f(req, resp)
-			if stats, ok := statistics[r.RequestURI]; ok {
-				if _, ok := stats[req.Session.UserID]; ok {
-					stats[req.Session.UserID]++
-				} else {
-					stats[req.Session.UserID] = 1
-					stats["totalUsers"]++
+			// dialog late to respond keeps running after handler returns, so it gets its own copies of request, state
+			// and logger, and response, which is put back to pool only if dialog responds in time
+			dialogReq := &alice.Request{}
+			*dialogReq = *req
+			dialogState := common.NewRequestState(stateRequest)
+			dialogLogger := requestLogger
+			dialogResp := initResponse(&respPool, req)
+			dialogCtx := statistics.Begin(common.WithRequestState(r.Context(), dialogState))
+			ctx, cancel := context.WithTimeout(logging.NewContext(dialogCtx, dialogLogger), responseTimeout)
+			defer cancel()
+			type result struct {
+				resp   *alice.Response
+				labels []string
+			}
+			done := make(chan result, 1)
+			go func() {
+				resp := handleSafely(dialogLogger, dialog, dialogReq, dialogResp, func() *alice.Response {
+					if page := pager.Continue(ctx, dialogReq, dialogResp); page != nil {
+						statistics.ReportCommand(ctx, "next_page")
+						return page
+					}
+					if result := handleIntents(ctx, dialogLogger, intentHandlers, body, dialogReq, dialogResp); result != nil {
+						return result
+					}
+					// intent handler passing request to dialog may leave parts of response
+					return f(ctx, dialogReq, resetResponse(dialogResp, dialogReq))
+				})
+				labels := statistics.End(ctx)
+				stats.Add(path, statistics.Event{
+					UserID:     dialogReq.Session.UserID,
+					SessionID:  dialogReq.Session.SessionID,
+					NewSession: dialogReq.Session.New,
+					Labels:     labels,
+				})
+				if ctx.Err() != nil {
+					// user got fallback response, pages of late response would be never shown
+					return
 				}
-				stats["totalMessages"]++
-			} else {
-				statistics[r.RequestURI] = map[string]int{}
-				statistics[r.RequestURI][req.Session.UserID] = 1
-				statistics[r.RequestURI]["totalMessages"] = 1
-				statistics[r.RequestURI]["totalUsers"] = 1
+				pager.Paginate(ctx, dialogReq, resp)
+				if !common.HasScreen(dialogReq) {
+					reply.ForSpeaker(resp)
+				}
+				done <- result{resp: resp, labels: labels}
+			}()
+			select {
+			case result := <-done:
+				resp = result.resp
+				state = dialogState
+				if len(result.labels) > 0 {
+					requestLogger = requestLogger.With("labels", result.labels)
+				}
+				for _, label := range result.labels {
+					if strings.HasPrefix(label, "state:") {
+						requestLogger = requestLogger.With("state", strings.TrimPrefix(label, "state:"))
+					}
+				}
+			case <-ctx.Done():
+				requestLogger.Warnf("Dialog did not respond in %v", responseTimeout)
+				metrics.ResponseTimeouts.Inc(path)
+				resp.Text("Секунду, думаю...")
 			}
 		} else {
 			resp.Text("4 пакета отправлено, 3 пакета получено. 1 пакет украли на почте")
-			log.Print("ping request")
+			requestLogger.Debugf("Ping request")
 		}
 
-		if debug == "true" {
-			log.Printf("Incomming request from host: %s. Request: { userId: %s, text: %s}. Response: { text: %s}",
-				r.RemoteAddr, req.Session.UserID, req.Text(), resp.Response.Text)
-		}
-		b, err := json.Marshal(resp)
+		requestLogger = requestLogger.With("latency_ms", time.Since(start).Milliseconds())
+		requestLogger.Infof("Request handled")
+		requestLogger.
+			With("text", logging.Text(req.Text())).
+			With("response", logging.Text(resp.Response.Text)).
+			Debugf("Request from host %s handled", r.RemoteAddr)
+		b, err := json.Marshal(state.Response(resp))
 		if err != nil {
-			log.Println(err)
+			requestLogger.Errorf("Cannot marshal response: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		if req.Request.OriginalUtterance != "ping" {
+			rec.Record(path, body, b)
+		}
+
 		w.WriteHeader(200)
 		w.Write(b)
 	}
 }
 
-func handleHealthRequest(dialogs []Dialog) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
+// contextHandler returns context-aware handler of dialog. Dialogs not implementing ContextDialog ignore the context.
+func contextHandler(dialog Dialog) func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	if contextDialog, ok := dialog.(ContextDialog); ok {
+		return contextDialog.HandleRequestContext()
+	}
+	f := dialog.HandleRequest()
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+		return f(request, response)
+	}
+}
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+// handleSafely returns response of handle. If handle panics, the panic is logged with stack trace and request context,
+// and user gets apology of dialog in apology response, which is cleared from the half of response written before panic.
+func handleSafely(requestLogger *logging.Logger, dialog Dialog, req *alice.Request, apology *alice.Response, handle func() *alice.Response) (resp *alice.Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			requestLogger.
+				With("text", logging.Text(req.Text())).
+				With("stack", string(runtimedebug.Stack())).
+				Errorf("Recovered panic: %v", r)
+			metrics.PanicsRecovered.Inc(dialog.GetPath())
+			resp = apologize(dialog, req, resetResponse(apology, req))
+		}
+	}()
+	return handle()
+}
 
-		for _, v := range dialogs {
-			ok, message := v.Health()
-			if !ok {
-				w.WriteHeader(500)
-				w.Write([]byte(message))
-				return
+func apologize(dialog Dialog, req *alice.Request, resp *alice.Response) *alice.Response {
+	if apologyDialog, ok := dialog.(ApologyDialog); ok {
+		return apologyDialog.Apology(req, resp)
+	}
+	resp.Text("Произошла ошибка, попробуйте в другой раз")
+	resp.Button("Закончить", "", true)
+	return resp
+}
+
+func handleIntents(ctx context.Context, requestLogger *logging.Logger, handlers map[string]nlu.Handler, body []byte, req *alice.Request, resp *alice.Response) *alice.Response {
+	if len(handlers) == 0 {
+		return nil
+	}
+	intents, err := nlu.Parse(body)
+	if err != nil {
+		requestLogger.Warnf("Cannot read intents of request: %v", err)
+		return nil
+	}
+	for _, name := range intents.Names() {
+		if h, ok := handlers[name]; ok {
+			if result := h(ctx, req, intents[name], resp); result != nil {
+				statistics.ReportIntent(ctx, name)
+				return result
 			}
 		}
-		w.WriteHeader(200)
-		w.Write([]byte("OK"))
 	}
+	return nil
+}
+
+type healthResponse struct {
+	Status  health.Status            `json:"status"`
+	Failed  []string                 `json:"failed,omitempty"`
+	Dialogs map[string]health.Result `json:"dialogs,omitempty"`
 }
 
-func handleStatisticsRequest() func(w http.ResponseWriter, r *http.Request) {
+// handleHealthRequest reports state of all dialogs. Returns 500 if any dialog is failed or disabled.
+func handleHealthRequest(checker *health.Checker) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		setCorsHeaders(w)
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		response := healthResponse{Status: health.StatusOK, Dialogs: checker.CheckAll()}
+		for _, name := range checker.Names() {
+			if !response.Dialogs[name].OK() {
+				response.Status = health.StatusFail
+				response.Failed = append(response.Failed, name)
+			}
+		}
+		status := http.StatusOK
+		if response.Status != health.StatusOK {
+			status = http.StatusInternalServerError
+		}
+		writeJson(w, status, response)
+	}
+}
 
-		responseStatistics := map[string]map[string]int{}
+// handleDialogHealthRequest reports state of dialog by name, which is the last element of dialog path.
+func handleDialogHealthRequest(checker *health.Checker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCorsHeaders(w)
 
-		for k, v := range statistics {
-			responseStatistics[k] = map[string]int{}
-			responseStatistics[k]["totalMessages"] = v["totalMessages"]
-			responseStatistics[k]["totalUsers"] = v["totalUsers"]
+		result, ok := checker.Check(mux.Vars(r)["dialog"])
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Dialog not found"}`))
+			return
+		}
+		status := http.StatusOK
+		if !result.OK() {
+			status = http.StatusInternalServerError
 		}
+		writeJson(w, status, result)
+	}
+}
 
-		b, err := json.Marshal(responseStatistics)
-		if err != nil {
-			log.Println(err)
-			w.WriteHeader(http.StatusInternalServerError)
+// handleLiveRequest reports that server is able to handle requests. It does not check dialogs.
+func handleLiveRequest() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCorsHeaders(w)
+		writeJson(w, http.StatusOK, healthResponse{Status: health.StatusOK})
+	}
+}
+
+// handleReadyRequest reports whether all working dialogs are able to serve users. Disabled dialogs are not checked.
+func handleReadyRequest(checker *health.Checker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCorsHeaders(w)
+
+		if ready, failed := checker.Ready(); !ready {
+			writeJson(w, http.StatusServiceUnavailable, healthResponse{Status: health.StatusFail, Failed: failed})
 			return
 		}
+		writeJson(w, http.StatusOK, healthResponse{Status: health.StatusOK})
+	}
+}
 
-		w.WriteHeader(200)
-		w.Write(b)
+func setCorsHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		logger.Errorf("Cannot marshal response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// requestID returns id of request for correlation of log events. Heroku router sends it in X-Request-Id header,
+// random id is generated otherwise. The id is returned in response header too.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get("X-Request-Id")
+	if id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
 	}
+	w.Header().Set("X-Request-Id", id)
+	return id
+}
+
+func initResponse(respPool *sync.Pool, req *alice.Request) *alice.Response {
+	return resetResponse(respPool.Get().(*alice.Response), req)
 }
 
-func initResponse(respPool sync.Pool, req *alice.Request) *alice.Response {
-	resp := respPool.Get().(*alice.Response)
+// resetResponse clears response of previous request from pool, or of handler which did not respond, and sets session
+// of request.
+func resetResponse(resp *alice.Response, req *alice.Request) *alice.Response {
+	*resp = alice.Response{}
 	resp.Session.MessageID = req.Session.MessageID
 	resp.Session.SessionID = req.Session.SessionID
 	resp.Session.UserID = req.Session.UserID
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/azzzak/alice"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yandex-dialogs/auth"
+	"yandex-dialogs/common"
+	"yandex-dialogs/metrics"
+	"yandex-dialogs/nlu"
+	"yandex-dialogs/simulator"
+	"yandex-dialogs/statistics"
+)
+
+type panicDialog struct {
+	path string
+}
+
+func (d *panicDialog) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		response.Text("половина ответа")
+		var values map[string]interface{}
+		return response.Text(values["text"].(string))
+	}
+}
+
+func (d *panicDialog) GetPath() string                      { return d.path }
+func (d *panicDialog) GetSkillID() string                   { return "" }
+func (d *panicDialog) Health() (bool, string)               { return true, "OK" }
+func (d *panicDialog) ApiHandlers(router *mux.Router)       {}
+func (d *panicDialog) Init(deps *common.Dependencies) error { return nil }
+func (d *panicDialog) Close(ctx context.Context) error      { return nil }
+
+type apologizingDialog struct {
+	panicDialog
+}
+
+func (d *apologizingDialog) Apology(request *alice.Request, response *alice.Response) *alice.Response {
+	return response.Text("Простите, " + request.Session.UserID)
+}
+
+func sendRequest(t *testing.T, dialog Dialog, text string) *alice.Response {
+	body, _ := json.Marshal(simulator.NewUser("user").Request(text))
+	w := httptest.NewRecorder()
+	h := handleRequest(dialog, nil, auth.AuthenticatorFunc(func(*http.Request, []byte, *alice.Request) error {
+		return nil
+	}), statistics.NewAggregator(nil), nil)
+	h(w, httptest.NewRequest("POST", dialog.GetPath(), bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	response := &alice.Response{}
+	if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestPanicIsRecovered(t *testing.T) {
+	response := sendRequest(t, &panicDialog{path: "/test/panic"}, "привет")
+	if response.Response.Text != "Произошла ошибка, попробуйте в другой раз" {
+		t.Errorf("expected default apology, got %q", response.Response.Text)
+	}
+	if response.Session.UserID != "user" || response.Version != "1.0" {
+		t.Errorf("expected session of request, got %+v", response.Session)
+	}
+
+	var metricsText bytes.Buffer
+	metrics.Default.Write(&metricsText)
+	if !strings.Contains(metricsText.String(), `dialogs_panics_recovered_total{path="/test/panic"} 1`) {
+		t.Errorf("expected panic to be counted, got:\n%s", metricsText.String())
+	}
+}
+
+func TestApologyOfDialog(t *testing.T) {
+	response := sendRequest(t, &apologizingDialog{panicDialog{path: "/test/apology"}}, "привет")
+	if response.Response.Text != "Простите, user" || len(response.Response.Buttons) != 0 {
+		t.Errorf("expected apology of dialog, got %+v", response.Response)
+	}
+}
+
+type slowDialog struct {
+	panicDialog
+	cancelled chan bool
+}
+
+func (d *slowDialog) HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+		select {
+		case <-ctx.Done():
+			d.cancelled <- true
+		case <-time.After(time.Second):
+			d.cancelled <- false
+		}
+		return response.Text("Поздно")
+	}
+}
+
+func TestFallbackOnTimeout(t *testing.T) {
+	defer func(timeout time.Duration) {
+		responseTimeout = timeout
+	}(responseTimeout)
+	responseTimeout = 50 * time.Millisecond
+
+	dialog := &slowDialog{panicDialog: panicDialog{path: "/test/slow"}, cancelled: make(chan bool, 1)}
+	response := sendRequest(t, dialog, "привет")
+	if response.Response.Text != "Секунду, думаю..." {
+		t.Errorf("expected fallback response, got %q", response.Response.Text)
+	}
+	if !<-dialog.cancelled {
+		t.Error("expected context of dialog to be cancelled")
+	}
+}
+
+type linkDialog struct {
+	panicDialog
+}
+
+func (d *linkDialog) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		response.Text(strings.Repeat("Очень длинный ответ. ", 100))
+		response.Button("Оценить", "https://dialogs.yandex.ru/store", false)
+		return response.Button("Выйти", "", true)
+	}
+}
+
+func TestResponseIsAdaptedToDevice(t *testing.T) {
+	dialog := &linkDialog{panicDialog{path: "/test/links"}}
+	h := handleRequest(dialog, nil, auth.AuthenticatorFunc(func(*http.Request, []byte, *alice.Request) error {
+		return nil
+	}), statistics.NewAggregator(nil), nil)
+	user := simulator.NewUser("user")
+	send := func() *alice.Response {
+		body, _ := json.Marshal(user.Request("привет"))
+		// Alice omits screen of speakers instead of sending null
+		body = bytes.Replace(body, []byte(`"interfaces":{"screen":null}`), []byte(`"interfaces":{}`), 1)
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("POST", dialog.GetPath(), bytes.NewReader(body)))
+		response := &alice.Response{}
+		if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response := send()
+	if len(response.Response.Buttons) != 2 || len([]rune(response.Response.Text)) > 1024 {
+		t.Errorf("expected link on screen and text cut to limit, got %d buttons and %d characters",
+			len(response.Response.Buttons), len([]rune(response.Response.Text)))
+	}
+	// pooled request of the previous phrase is reused for body without screen
+	user.Speaker = true
+	response = send()
+	if len(response.Response.Buttons) != 1 || response.Response.Buttons[0].Title != "Выйти" {
+		t.Errorf("expected no links on speaker, got %+v", response.Response.Buttons)
+	}
+}
+
+func TestSkillIDOfPreviousRequestIsNotReused(t *testing.T) {
+	dialog := &linkDialog{panicDialog{path: "/test/skill"}}
+	h := handleRequest(dialog, nil, auth.SkillID("skill"), statistics.NewAggregator(nil), nil)
+	user := simulator.NewUser("user")
+	send := func(skillID string) int {
+		request := user.Request("привет")
+		request.Session.SkillID = skillID
+		body, _ := json.Marshal(request)
+		// body without skill id
+		body = bytes.Replace(body, []byte(`"skill_id":"",`), nil, 1)
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("POST", dialog.GetPath(), bytes.NewReader(body)))
+		return w.Code
+	}
+	if code := send("skill"); code != http.StatusOK {
+		t.Fatalf("expected request of skill to be accepted, got %d", code)
+	}
+	if code := send(""); code != http.StatusForbidden {
+		t.Errorf("expected request without skill id to be rejected, got %d", code)
+	}
+
+	var metricsText bytes.Buffer
+	metrics.Default.Write(&metricsText)
+	if !strings.Contains(metricsText.String(), `dialogs_auth_rejections_total{path="/test/skill",reason="skill_id"} 1`) {
+		t.Errorf("expected rejection to be counted, got:\n%s", metricsText.String())
+	}
+}
+
+type intentDialog struct {
+	panicDialog
+}
+
+func (d *intentDialog) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		return response.Text("Ответ диалога")
+	}
+}
+
+func (d *intentDialog) IntentHandlers() map[string]nlu.Handler {
+	return map[string]nlu.Handler{
+		"greeting": func(ctx context.Context, request *alice.Request, intent nlu.Intent, response *alice.Response) *alice.Response {
+			return response.Text("Ответ на интент")
+		},
+		"unknown": func(ctx context.Context, request *alice.Request, intent nlu.Intent, response *alice.Response) *alice.Response {
+			response.Text("Не ")
+			return nil
+		},
+	}
+}
+
+func TestIntentHandlers(t *testing.T) {
+	dialog := &intentDialog{panicDialog{path: "/test/intents"}}
+	h := handleRequest(dialog, nil, auth.AuthenticatorFunc(func(*http.Request, []byte, *alice.Request) error {
+		return nil
+	}), statistics.NewAggregator(nil), nil)
+	send := func(intent string) string {
+		body, _ := json.Marshal(simulator.NewUser("user").Request("привет"))
+		body = bytes.Replace(body, []byte(`"nlu":{`), []byte(`"nlu":{"intents":{"`+intent+`":{"slots":{}}},`), 1)
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("POST", dialog.GetPath(), bytes.NewReader(body)))
+		response := &alice.Response{}
+		if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Response.Text
+	}
+	if text := send("greeting"); text != "Ответ на интент" {
+		t.Errorf("expected response of intent handler, got %q", text)
+	}
+	// handler returning nil passes request to dialog with clean response
+	if text := send("unknown"); text != "Ответ диалога" {
+		t.Errorf("expected response of dialog, got %q", text)
+	}
+	if text := send("other"); text != "Ответ диалога" {
+		t.Errorf("expected response of dialog, got %q", text)
+	}
+}
@@ -0,0 +1,108 @@
+// Package harness drives dialogs through scripted conversations in tests, without server and external services.
+package harness
+
+import (
+	"fmt"
+	"github.com/azzzak/alice"
+	"strings"
+	"testing"
+	"yandex-dialogs/common"
+	"yandex-dialogs/config"
+	"yandex-dialogs/simulator"
+)
+
+// Dialog is the part of dialog interface used by harness.
+type Dialog interface {
+	HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response
+}
+
+// Step is a phrase of user and expected answer of dialog.
+type Step struct {
+	// Phrase of user. Empty phrase is sent when user starts skill without command.
+	Say string
+	// Starts new session before phrase.
+	NewSession bool
+	// Expected substrings of response text.
+	Text []string
+	// Expected titles of buttons in order. Nil means buttons are not checked, empty slice means no buttons.
+	Buttons []string
+	// Expected `end_session` flag.
+	EndSession bool
+}
+
+// Conversation of one user with dialog. The first phrase starts new session.
+type Conversation struct {
+	t      testing.TB
+	handle func(request *alice.Request, response *alice.Response) *alice.Response
+	user   *simulator.User
+}
+
+func NewConversation(t testing.TB, dialog Dialog, userID string) *Conversation {
+	return &Conversation{t: t, handle: dialog.HandleRequest(), user: simulator.NewUser(userID)}
+}
+
+// NewSession makes the next phrase start new session, as if user closed and opened skill again.
+func (c *Conversation) NewSession() {
+	c.user.NewSession()
+}
+
+// WithoutScreen makes user talk from smart speaker without screen.
+func (c *Conversation) WithoutScreen() *Conversation {
+	c.user.Speaker = true
+	return c
+}
+
+// Say sends phrase of user to dialog and returns response.
+func (c *Conversation) Say(text string) *alice.Response {
+	request := c.user.Request(text)
+	return c.handle(request, simulator.NewResponse(request))
+}
+
+// Run sends phrases of steps one by one and stops test at the first unexpected response.
+func (c *Conversation) Run(steps ...Step) {
+	c.t.Helper()
+	for i, step := range steps {
+		if step.NewSession {
+			c.NewSession()
+		}
+		response := c.Say(step.Say)
+		if err := Check(response, step); err != nil {
+			c.t.Fatalf("step %d, user %s says %q: %v", i+1, c.user.ID, step.Say, err)
+		}
+	}
+}
+
+// Check returns error describing the first difference of response from expected in step.
+func Check(response *alice.Response, step Step) error {
+	if response == nil {
+		return fmt.Errorf("no response")
+	}
+	for _, text := range step.Text {
+		if !strings.Contains(response.Response.Text, text) {
+			return fmt.Errorf("expected text containing %q, got %q", text, response.Response.Text)
+		}
+	}
+	if step.Buttons != nil {
+		titles := []string{}
+		for _, button := range response.Response.Buttons {
+			titles = append(titles, button.Title)
+		}
+		if strings.Join(titles, "|") != strings.Join(step.Buttons, "|") {
+			return fmt.Errorf("expected buttons %q, got %q", step.Buttons, titles)
+		}
+	}
+	if response.Response.EndSession != step.EndSession {
+		return fmt.Errorf("expected end_session %v, got %v", step.EndSession, response.Response.EndSession)
+	}
+	return nil
+}
+
+// NewDependencies returns dependencies with settings from values, keeping sessions in memory unless configured otherwise.
+// Settings missing in values are read from environment, as usual.
+func NewDependencies(values map[string]string) *common.Dependencies {
+	settings := map[string]string{"SESSION_STORE": "memory"}
+	for key, value := range values {
+		settings[key] = value
+	}
+	return common.NewDependencies(config.New(settings))
+}
@@ -0,0 +1,174 @@
+package health
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"yandex-dialogs/metrics"
+)
+
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusFail     Status = "fail"
+	StatusDisabled Status = "disabled"
+)
+
+// Check returns state of component (true - ok, false - something is wrong) and additional message.
+type Check func() (result bool, message string)
+
+// Result is the last result of check. Latency is duration of check in milliseconds.
+type Result struct {
+	Status      Status     `json:"status"`
+	Message     string     `json:"message,omitempty"`
+	Latency     float64    `json:"latencyMs"`
+	CheckedAt   *time.Time `json:"checkedAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+func (r Result) OK() bool {
+	return r.Status == StatusOK
+}
+
+type entry struct {
+	mux    sync.Mutex
+	check  Check
+	result Result
+}
+
+// Checker runs checks of components and caches their results for interval,
+// so frequent probes do not hammer DBs and external APIs.
+// Components should be added before checker is used concurrently.
+type Checker struct {
+	interval time.Duration
+	names    []string
+	entries  map[string]*entry
+}
+
+func NewChecker(interval time.Duration) *Checker {
+	return &Checker{interval: interval, entries: map[string]*entry{}}
+}
+
+// Add registers component with check.
+func (c *Checker) Add(name string, check Check) {
+	c.names = append(c.names, name)
+	c.entries[name] = &entry{check: check}
+}
+
+// AddDisabled registers component, which failed to start. It is always reported as disabled with the error.
+func (c *Checker) AddDisabled(name string, err error) {
+	now := time.Now()
+	c.names = append(c.names, name)
+	c.entries[name] = &entry{result: Result{
+		Status:      StatusDisabled,
+		Message:     err.Error(),
+		LastError:   err.Error(),
+		LastErrorAt: &now,
+	}}
+}
+
+// Names returns names of components in order of registration.
+func (c *Checker) Names() []string {
+	return c.names
+}
+
+// Check returns result of component check. Returns false if there is no component with the name.
+func (c *Checker) Check(name string) (Result, bool) {
+	e, ok := c.entries[name]
+	if !ok {
+		return Result{}, false
+	}
+	return e.get(c.interval), true
+}
+
+// CheckAll checks all components in parallel and returns results by name.
+func (c *Checker) CheckAll() map[string]Result {
+	results := make([]Result, len(c.names))
+	var wg sync.WaitGroup
+	for i, name := range c.names {
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			results[i] = e.get(c.interval)
+		}(i, c.entries[name])
+	}
+	wg.Wait()
+	byName := map[string]Result{}
+	for i, name := range c.names {
+		byName[name] = results[i]
+	}
+	return byName
+}
+
+// Ready reports whether all started components are ok. Disabled components are not taken into account,
+// as they will not recover until restart.
+func (c *Checker) Ready() (bool, []string) {
+	var failed []string
+	for name, result := range c.CheckAll() {
+		if result.Status == StatusFail {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return len(failed) == 0, failed
+}
+
+// Watch checks all components every interval until stop is closed, so that components recovering in checks, like
+// connections to DBs, recover without probes of health endpoints.
+func (c *Checker) Watch(stop <-chan struct{}) {
+	if c.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.CheckAll()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (e *entry) get(interval time.Duration) Result {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.check == nil {
+		return e.result
+	}
+	if e.result.CheckedAt != nil && time.Since(*e.result.CheckedAt) < interval {
+		return e.result
+	}
+	start := time.Now()
+	ok, message := e.check()
+	now := time.Now()
+	e.result.Latency = float64(now.Sub(start).Microseconds()) / 1000
+	e.result.CheckedAt = &now
+	e.result.Message = message
+	if ok {
+		e.result.Status = StatusOK
+	} else {
+		e.result.Status = StatusFail
+		e.result.LastError = message
+		e.result.LastErrorAt = &now
+	}
+	return e.result
+}
+
+// Upstream returns state of upstream by outcome of the last request to it made by dialogs, so that checks do not
+// send requests to external APIs themselves. Upstream without requests yet is considered ok.
+func Upstream(upstream string) (result bool, message string) {
+	state, ok := metrics.LastUpstream(upstream)
+	switch {
+	case !ok:
+		return true, "No requests yet"
+	case state.Err != nil:
+		return false, fmt.Sprintf("Last request at %s failed: %v", state.At.Format(time.RFC3339), state.Err)
+	default:
+		return true, fmt.Sprintf("OK, last request took %d ms", state.Latency.Milliseconds())
+	}
+}
@@ -0,0 +1,170 @@
+package intents
+
+import (
+	"strings"
+	"unicode"
+	"yandex-dialogs/fuzzy"
+)
+
+// Intent is a command which can be recognized in user phrase.
+//
+// Phrases are matched by whole words, so "не" does not match "нет" and "все" does not match "всем".
+// Word ending with `*` is a stem and matches any word starting with it, e.g. "провер*" matches "проверь" and "проверить".
+// Intent with Exact flag matches only if the whole user phrase is equal to one of phrases.
+// When several intents match, the one with the highest Priority wins, then the one with higher confidence.
+// If no phrase matches exactly, words are compared fuzzily to tolerate speech recognition mistakes.
+type Intent struct {
+	Name     string
+	Phrases  []string
+	Priority int
+	Exact    bool
+}
+
+// Match is a result of matching. Name is empty if nothing matched.
+// Confidence is a share of words of user phrase covered by matched phrase, from 0 to 1.
+type Match struct {
+	Name       string
+	Confidence float64
+}
+
+type compiledIntent struct {
+	Intent
+	phrases [][]string
+}
+
+type Matcher struct {
+	intents []compiledIntent
+}
+
+func NewMatcher(intents ...Intent) *Matcher {
+	m := &Matcher{}
+	for _, intent := range intents {
+		compiled := compiledIntent{Intent: intent}
+		for _, phrase := range intent.Phrases {
+			if tokens := Tokenize(phrase); len(tokens) > 0 {
+				compiled.phrases = append(compiled.phrases, tokens)
+			}
+		}
+		m.intents = append(m.intents, compiled)
+	}
+	return m
+}
+
+// Match returns the best intent for text among intents with given names, or among all intents if names are not specified.
+func (m *Matcher) Match(text string, names ...string) Match {
+	return m.match(Tokenize(text), false, names)
+}
+
+// MatchExact is like Match, but considers only phrases equal to the whole text.
+// Useful in states where user says arbitrary text, like message body or name.
+func (m *Matcher) MatchExact(text string, names ...string) Match {
+	return m.match(Tokenize(text), true, names)
+}
+
+// Is reports whether text matches intent with the name.
+func (m *Matcher) Is(text string, name string) bool {
+	tokens := Tokenize(text)
+	for _, fuzzyMode := range []bool{false, true} {
+		for _, intent := range m.intents {
+			if intent.Name == name && intent.confidence(tokens, false, fuzzyMode) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Matcher) match(tokens []string, exact bool, names []string) Match {
+	if best := m.bestMatch(tokens, exact, false, names); best.Name != "" {
+		return best
+	}
+	return m.bestMatch(tokens, exact, true, names)
+}
+
+func (m *Matcher) bestMatch(tokens []string, exact bool, fuzzyMode bool, names []string) Match {
+	best := Match{}
+	bestPriority := 0
+	for _, intent := range m.intents {
+		if len(names) > 0 && !contains(names, intent.Name) {
+			continue
+		}
+		confidence := intent.confidence(tokens, exact, fuzzyMode)
+		if confidence == 0 {
+			continue
+		}
+		if best.Name == "" || intent.Priority > bestPriority ||
+			(intent.Priority == bestPriority && confidence > best.Confidence) {
+			best = Match{Name: intent.Name, Confidence: confidence}
+			bestPriority = intent.Priority
+		}
+	}
+	return best
+}
+
+func (i compiledIntent) confidence(tokens []string, exact bool, fuzzyMode bool) float64 {
+	if len(tokens) == 0 {
+		return 0
+	}
+	best := 0.0
+	for _, phrase := range i.phrases {
+		if (exact || i.Exact) && len(phrase) != len(tokens) {
+			continue
+		}
+		if containsPhrase(tokens, phrase, fuzzyMode) {
+			if confidence := float64(len(phrase)) / float64(len(tokens)); confidence > best {
+				best = confidence
+			}
+		}
+	}
+	if best > 1 {
+		best = 1
+	}
+	return best
+}
+
+func containsPhrase(tokens []string, phrase []string, fuzzyMode bool) bool {
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		matched := true
+		for j, word := range phrase {
+			if !matchWord(word, tokens[i+j], fuzzyMode) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func matchWord(pattern string, token string, fuzzyMode bool) bool {
+	if strings.HasSuffix(pattern, "*") {
+		stem := strings.TrimSuffix(pattern, "*")
+		if fuzzyMode {
+			return fuzzy.HasPrefix(token, stem)
+		}
+		return strings.HasPrefix(token, stem)
+	}
+	if fuzzyMode {
+		return fuzzy.Equal(pattern, token)
+	}
+	return pattern == token
+}
+
+// Tokenize splits text into lower-cased words, ignoring punctuation. Letter "ё" is replaced with "е".
+func Tokenize(text string) []string {
+	text = strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '*'
+	})
+}
+
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
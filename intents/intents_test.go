@@ -0,0 +1,85 @@
+package intents
+
+import (
+	"reflect"
+	"testing"
+)
+
+var matcher = NewMatcher(
+	Intent{Name: "negative", Phrases: []string{"нет", "не надо"}},
+	Intent{Name: "accept", Phrases: []string{"да", "давай"}},
+	Intent{Name: "exit", Phrases: []string{"все", "хватит"}, Priority: 10},
+	Intent{Name: "check", Phrases: []string{"провер* почту"}},
+	Intent{Name: "send", Phrases: []string{"отправ*"}},
+	Intent{Name: "help", Phrases: []string{"помощь"}, Exact: true},
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		// "не" is not "нет"
+		{"нет", "negative"},
+		{"не надо", "negative"},
+		{"не знаю", ""},
+		{"нету", ""},
+		// "все" is matched by whole word only
+		{"все", "exit"},
+		{"всё", "exit"},
+		{"ну всё, хватит", "exit"},
+		{"всем привет", ""},
+		{"привет всем", ""},
+		// stems
+		{"проверь почту", "check"},
+		{"проверить почту", "check"},
+		{"почту проверь", ""},
+		{"отправить сообщение", "send"},
+		{"отправь", "send"},
+		{"правь", ""},
+		// exact intent
+		{"помощь", "help"},
+		{"нужна помощь", ""},
+		// priority wins over order
+		{"да хватит", "exit"},
+		// recognition mistakes
+		{"отпраить сообщение", "send"},
+		{"проверть почту", "check"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := matcher.Match(test.text).Name; got != test.want {
+			t.Errorf("Match(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestMatchOfNames(t *testing.T) {
+	if got := matcher.Match("да хватит", "accept", "negative").Name; got != "accept" {
+		t.Errorf("expected match among given intents, got %q", got)
+	}
+	if got := matcher.MatchExact("отправь сообщение", "send").Name; got != "" {
+		t.Errorf("expected no exact match of longer phrase, got %q", got)
+	}
+	if got := matcher.MatchExact("Отправь!", "send").Name; got != "send" {
+		t.Errorf("expected exact match, got %q", got)
+	}
+	if !matcher.Is("ну всё", "exit") || matcher.Is("всем", "exit") {
+		t.Error("unexpected Is result")
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	if m := matcher.Match("проверь почту"); m.Confidence != 1 {
+		t.Errorf("expected full confidence, got %v", m.Confidence)
+	}
+	if m := matcher.Match("пожалуйста, проверь почту"); m.Name != "check" || m.Confidence < 0.66 || m.Confidence > 0.67 {
+		t.Errorf("expected confidence of 2 of 3 words, got %+v", m)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	if got := Tokenize("Ещё раз, проверь-ка  почту!"); !reflect.DeepEqual(got, []string{"еще", "раз", "проверь", "ка", "почту"}) {
+		t.Errorf("unexpected tokens %q", got)
+	}
+}
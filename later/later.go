@@ -0,0 +1,71 @@
+// Package later keeps answers of slow upstreams, which came after user got response, to deliver them with the next response.
+package later
+
+import (
+	"context"
+	"github.com/patrickmn/go-cache"
+	"time"
+	"yandex-dialogs/logging"
+)
+
+var logger = logging.For("later")
+
+// Reminder starts the text of answer delivered later.
+const Reminder = "Я вспомнила, что хотела ответить: "
+
+// Margin is time left before deadline of request to build response after upstream is given up.
+const Margin = 300 * time.Millisecond
+
+// Answers keeps late answers by key, usually session id, for ttl. It is safe for concurrent use.
+type Answers struct {
+	cache *cache.Cache
+}
+
+func NewAnswers(ttl time.Duration) *Answers {
+	return &Answers{cache: cache.New(ttl, ttl)}
+}
+
+// Get calls fetch and waits for the answer until Margin before deadline of ctx. If the answer is late, Get returns false,
+// and fetch keeps running in background, limited by timeouts of upstream client only. Its answer is stored by key then.
+func (a *Answers) Get(ctx context.Context, key string, fetch func(ctx context.Context) (string, error)) (string, bool, error) {
+	type result struct {
+		answer string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		answer, err := fetch(context.Background())
+		done <- result{answer: answer, err: err}
+	}()
+
+	wait := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		wait, cancel = context.WithDeadline(ctx, deadline.Add(-Margin))
+		defer cancel()
+	}
+	select {
+	case r := <-done:
+		return r.answer, true, r.err
+	case <-wait.Done():
+		go func() {
+			r := <-done
+			if r.err != nil {
+				logger.Warnf("Late answer is failed: %v", r.err)
+				return
+			}
+			a.cache.SetDefault(key, r.answer)
+		}()
+		return "", false, nil
+	}
+}
+
+// Take returns answer stored for key and removes it. Returns false if there is no answer yet.
+func (a *Answers) Take(key string) (string, bool) {
+	value, ok := a.cache.Get(key)
+	if !ok {
+		return "", false
+	}
+	a.cache.Delete(key)
+	return value.(string), true
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+)
+
+// AccessHandler writes event of access package for each request to h, like access log of web server:
+// method, path, status and size of response, latency, remote address and user agent of client.
+// Request id set to X-Request-Id header of response is added, so access event is correlated with events of request.
+func AccessHandler(h http.Handler) http.Handler {
+	logger := For("access")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(recorder, r)
+		event := logger.
+			With("method", r.Method).
+			With("path", r.URL.Path).
+			With("status", recorder.status).
+			With("size", recorder.size).
+			With("latency_ms", time.Since(start).Milliseconds()).
+			With("remote_addr", r.RemoteAddr).
+			With("user_agent", r.UserAgent())
+		if id := w.Header().Get("X-Request-Id"); id != "" {
+			event = event.With("request_id", id)
+		}
+		event.Infof("%s %s %d", r.Method, r.URL.Path, recorder.status)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
@@ -0,0 +1,255 @@
+// Package logging writes structured log as JSON lines, one object per event.
+//
+// Levels are configured by LOG_LEVEL (`debug`, `info`, `warn` or `error`, `info` by default)
+// and overridden per package by LOG_LEVELS, for example `voice_mail=debug,statistics=warn`.
+// User texts and identifiers are redacted unless LOG_USER_TEXT=true, see Text and ID.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns level by name, false if name is unknown.
+func ParseLevel(name string) (Level, bool) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(strings.TrimSpace(name), levelName) {
+			return Level(i), true
+		}
+	}
+	return LevelInfo, false
+}
+
+type config struct {
+	mux          sync.RWMutex
+	out          io.Writer
+	level        Level
+	levels       map[string]Level
+	showUserText bool
+}
+
+var current = &config{out: os.Stderr, level: LevelInfo, levels: map[string]Level{}}
+
+func init() {
+	Configure(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_LEVELS"), os.Getenv("LOG_USER_TEXT") == "true")
+}
+
+// Configure sets default level, levels of packages as `package=level` pairs separated by commas,
+// and whether user texts are logged as is. Unknown levels are reported and ignored.
+func Configure(level string, packageLevels string, showUserText bool) {
+	c := current
+	c.mux.Lock()
+	c.level = LevelInfo
+	c.levels = map[string]Level{}
+	c.showUserText = showUserText
+	var unknown []string
+	if level != "" {
+		if l, ok := ParseLevel(level); ok {
+			c.level = l
+		} else {
+			unknown = append(unknown, level)
+		}
+	}
+	for _, pair := range strings.Split(packageLevels, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			unknown = append(unknown, pair)
+			continue
+		}
+		if l, ok := ParseLevel(parts[1]); ok {
+			c.levels[strings.TrimSpace(parts[0])] = l
+		} else {
+			unknown = append(unknown, pair)
+		}
+	}
+	c.mux.Unlock()
+	for _, u := range unknown {
+		For("logging").Warnf("Unknown log level %q is ignored", u)
+	}
+}
+
+// SetOutput sets writer of log lines, os.Stderr by default.
+func SetOutput(w io.Writer) {
+	current.mux.Lock()
+	defer current.mux.Unlock()
+	current.out = w
+}
+
+func (c *config) enabled(pkg string, level Level) bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if l, ok := c.levels[pkg]; ok {
+		return level >= l
+	}
+	return level >= c.level
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Logger writes events of package with fields attached by With. Loggers are immutable and safe for concurrent use.
+type Logger struct {
+	pkg    string
+	fields []field
+}
+
+// For returns logger of package. Level of package is configured by LOG_LEVELS.
+func For(pkg string) *Logger {
+	return &Logger{pkg: pkg}
+}
+
+// With returns logger adding field to all events. Field with the same key replaces the previous one.
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make([]field, 0, len(l.fields)+1)
+	for _, f := range l.fields {
+		if f.key != key {
+			fields = append(fields, f)
+		}
+	}
+	return &Logger{pkg: l.pkg, fields: append(fields, field{key: key, value: value})}
+}
+
+// Package returns logger with the same fields for another package, so events of one request are correlated across packages.
+func (l *Logger) Package(pkg string) *Logger {
+	return &Logger{pkg: pkg, fields: l.fields}
+}
+
+// Enabled reports whether events of level are written, to skip building expensive messages.
+func (l *Logger) Enabled(level Level) bool {
+	return current.enabled(l.pkg, level)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(LevelDebug, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(LevelInfo, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(LevelWarn, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(LevelError, format, args...)
+}
+
+func (l *Logger) log(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeField(&buf, "time", time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeField(&buf, "level", level.String())
+	buf.WriteByte(',')
+	writeField(&buf, "package", l.pkg)
+	buf.WriteByte(',')
+	writeField(&buf, "msg", fmt.Sprintf(format, args...))
+	for _, f := range l.fields {
+		buf.WriteByte(',')
+		writeField(&buf, f.key, f.value)
+	}
+	buf.WriteString("}\n")
+
+	current.mux.Lock()
+	defer current.mux.Unlock()
+	current.out.Write(buf.Bytes())
+}
+
+func writeField(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(v)
+}
+
+type contextKey struct{}
+
+// NewContext returns context carrying logger of request.
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns logger of request carried by ctx for package, or logger of package if ctx has no logger.
+func FromContext(ctx context.Context, pkg string) *Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return logger.Package(pkg)
+	}
+	return For(pkg)
+}
+
+// Text returns user text for log: the text itself if LOG_USER_TEXT=true, only its length otherwise.
+func Text(text string) string {
+	current.mux.RLock()
+	defer current.mux.RUnlock()
+	if current.showUserText {
+		return text
+	}
+	return fmt.Sprintf("<%d chars>", utf8.RuneCountInString(text))
+}
+
+// ID returns pseudonym of identifier or token for log, so events of the same user are correlated without revealing the id.
+// User id is a secret token in voice mail.
+func ID(id string) string {
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:6])
+}
+
+// StandardWriter returns writer for standard log package, writing each line as event of package on level.
+// Use it with log.SetOutput and log.SetFlags(0) to keep all output in JSON.
+func StandardWriter(pkg string, level Level) io.Writer {
+	return standardWriter{logger: For(pkg), level: level}
+}
+
+type standardWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w standardWriter) Write(p []byte) (int, error) {
+	w.logger.log(w.level, "%s", strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
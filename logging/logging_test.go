@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func capture(t *testing.T, level, packageLevels string, showUserText bool) (*bytes.Buffer, func()) {
+	var buf bytes.Buffer
+	Configure(level, packageLevels, showUserText)
+	SetOutput(&buf)
+	return &buf, func() {
+		SetOutput(os.Stderr)
+		Configure("", "", false)
+	}
+}
+
+func events(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		event := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line is not JSON: %s", line)
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+func TestLevels(t *testing.T) {
+	buf, restore := capture(t, "warn", "voice_mail=debug", false)
+	defer restore()
+
+	For("masha").Infof("skipped")
+	For("masha").Warnf("written")
+	For("voice_mail").Debugf("written")
+
+	logged := events(t, buf)
+	if len(logged) != 2 {
+		t.Fatalf("expected 2 events, got %v", logged)
+	}
+	if logged[0]["package"] != "masha" || logged[0]["level"] != "warn" || logged[1]["package"] != "voice_mail" {
+		t.Errorf("unexpected events %v", logged)
+	}
+}
+
+func TestFieldsOfContext(t *testing.T) {
+	buf, restore := capture(t, "", "", false)
+	defer restore()
+
+	ctx := NewContext(context.Background(), For("main").With("session_id", "s1").With("message_id", 1))
+	FromContext(ctx, "masha").With("message_id", 2).Errorf("Cannot get answer: %v", "timeout")
+
+	logged := events(t, buf)
+	if len(logged) != 1 {
+		t.Fatalf("expected 1 event, got %v", logged)
+	}
+	event := logged[0]
+	if event["package"] != "masha" || event["session_id"] != "s1" || event["message_id"] != float64(2) ||
+		event["msg"] != "Cannot get answer: timeout" {
+		t.Errorf("unexpected event %v", event)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	_, restore := capture(t, "", "", false)
+	defer restore()
+
+	if text := Text("мой секрет"); text != "<10 chars>" {
+		t.Errorf("expected redacted text, got %q", text)
+	}
+	if id := ID("user-token"); id == "" || strings.Contains(id, "user-token") || id != ID("user-token") {
+		t.Errorf("expected stable pseudonym, got %q", id)
+	}
+
+	Configure("", "", true)
+	if text := Text("мой секрет"); text != "мой секрет" {
+		t.Errorf("expected text as is, got %q", text)
+	}
+}
+
+func TestAccessHandler(t *testing.T) {
+	buf, restore := capture(t, "info", "", false)
+	defer restore()
+
+	h := AccessHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "42")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+	}))
+	r := httptest.NewRequest("POST", "/api/dialogs/masha?debug=1", nil)
+	r.Header.Set("User-Agent", "Alice")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	logged := events(t, buf)
+	if len(logged) != 1 {
+		t.Fatalf("expected access event, got %v", logged)
+	}
+	event := logged[0]
+	if event["package"] != "access" || event["method"] != "POST" || event["path"] != "/api/dialogs/masha" ||
+		event["status"] != float64(403) || event["size"] != float64(9) || event["user_agent"] != "Alice" || event["request_id"] != "42" {
+		t.Errorf("unexpected access event %v", event)
+	}
+}
@@ -1,98 +1,353 @@
 package main
 
 import (
-	"flag"
+	"context"
 	"fmt"
-	"github.com/azzzak/alice"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"golang.org/x/sync/errgroup"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+	"yandex-dialogs/auth"
 	"yandex-dialogs/common"
-	"yandex-dialogs/coronavirus"
-	"yandex-dialogs/masha"
-	"yandex-dialogs/phrases_generator"
-	"yandex-dialogs/stalker"
-	"yandex-dialogs/voice_mail"
+	"yandex-dialogs/config"
+	_ "yandex-dialogs/coronavirus"
+	_ "yandex-dialogs/good_morning"
+	"yandex-dialogs/health"
+	"yandex-dialogs/logging"
+	_ "yandex-dialogs/masha"
+	"yandex-dialogs/metrics"
+	_ "yandex-dialogs/phrases_generator"
+	"yandex-dialogs/recorder"
+	"yandex-dialogs/registry"
+	"yandex-dialogs/reply"
+	_ "yandex-dialogs/stalker"
+	"yandex-dialogs/statistics"
+	_ "yandex-dialogs/voice_mail"
 )
 
-// 1. Implement your handler (dialog) complying this interface. Put implementation in separated folder/package.
-type Dialog interface {
-	// Returns func which takes incoming Alice request and prepared response with filled `session` information. Response should be returned.
-	HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response
+var logger = logging.For("main")
 
-	// Returns base path of your dialog REST API. For example, `/api/dialogs/sample-dialog`
-	GetPath() string
-
-	// Returns state of dialog (true - ok, false - something is wrong) and additional string message.
-	Health() (result bool, message string)
-
-	// Additional custom HTTP request handlers
-	ApiHandlers(router *mux.Router)
-}
+// Dialogs are defined and registered in registry package, see how to implement a new one there.
+type (
+	Dialog        = registry.Dialog
+	IntentDialog  = registry.IntentDialog
+	ApologyDialog = registry.ApologyDialog
+	ContextDialog = registry.ContextDialog
+	PagedDialog   = registry.PagedDialog
+)
 
+// Timeouts are set from server settings by loadConfig
 var (
-	serveHost = flag.String("serve_host", common.GetEnv("SERVER_HOST", ""),
-		"Host to serve requests incoming to server")
-	servePort = flag.String("serve_port", common.GetEnv("PORT", "8080"),
-		"Port to serve requests incoming to server")
-	g errgroup.Group
+	shutdownTimeout = 25 * time.Second
+	responseTimeout = 2500 * time.Millisecond
 )
 
-// 2. Just add your implementation here
-func buildHandlers() []Dialog {
+// buildHandlers creates dialogs mounted by config, or all registered dialogs on default paths, if config has no mounts.
+// Dialogs disabled in config are skipped, dialogs with invalid settings are returned with errors.
+// Error is returned if mounts refer to unknown dialogs, have invalid options or share a path.
+func buildHandlers(cfg *config.Config) ([]Dialog, map[Dialog]error, error) {
+	mounts := cfg.Mounts
+	if len(mounts) == 0 {
+		for _, name := range registry.Names() {
+			mounts = append(mounts, config.Mount{Dialog: name})
+		}
+	}
 	var dialogs []Dialog
-	dialogs = append(dialogs, phrases_generator.NewDialog())
-	dialogs = append(dialogs, voice_mail.NewVoiceMail())
-	dialogs = append(dialogs, masha.NewMasha(2900))
-	dialogs = append(dialogs, coronavirus.NewCoronavirus())
-	dialogs = append(dialogs, stalker.NewStalker())
-	return dialogs
+	disabled := map[Dialog]error{}
+	paths := map[string]string{}
+	for _, mount := range mounts {
+		if !cfg.Enabled(mount.Dialog) {
+			logger.Infof("Dialog %s is disabled by config", mount.Dialog)
+			continue
+		}
+		dialog, err := registry.New(mount.Dialog, mount.Path, mount.Options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot mount dialog %s: %v", mount.Dialog, err)
+		}
+		if other, ok := paths[dialog.GetPath()]; ok {
+			return nil, nil, fmt.Errorf("dialogs %s and %s are mounted on the same path %s", other, mount.Dialog, dialog.GetPath())
+		}
+		paths[dialog.GetPath()] = mount.Dialog
+		if err := cfg.DialogError(mount.Dialog); err != nil {
+			logger.Errorf("Dialog %s is disabled: %v", dialog.GetPath(), err)
+			disabled[dialog] = err
+			continue
+		}
+		dialogs = append(dialogs, dialog)
+	}
+	return dialogs, disabled, nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replay(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "chat" {
+		os.Exit(chat(os.Args[2:]))
+	}
+
+	// libraries log with standard logger, their events are written as structured events too
+	log.SetFlags(0)
+	log.SetOutput(logging.StandardWriter("log", logging.LevelInfo))
+
+	cfg := loadConfig()
+	reportConfig(cfg)
+	deps := common.NewDependencies(cfg)
+	mounted, disabled, err := buildHandlers(cfg)
+	if err != nil {
+		logger.Errorf("Cannot build dialogs: %v", err)
+		os.Exit(1)
+	}
+	dialogs := initDialogs(mounted, disabled, deps)
+	checker := newHealthChecker(dialogs, disabled, deps)
+	stats := newStatistics(deps)
+	rec := newRecorder(deps)
+
 	mainEndpoints := &http.Server{
-		Addr:    fmt.Sprintf("%s:%s", *serveHost, *servePort),
-		Handler: handler(),
+		Addr:    fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
+		Handler: handler(dialogs, checker, stats, rec, deps),
 	}
 
+	g, ctx := errgroup.WithContext(context.Background())
+	go checker.Watch(ctx.Done())
+	g.Go(func() error {
+		if err := mainEndpoints.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
+
 	g.Go(func() error {
-		return mainEndpoints.ListenAndServe()
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		select {
+		case sig := <-signals:
+			logger.Infof("Received %v, shutting down", sig)
+			shutdown(mainEndpoints, dialogs, stats, deps)
+		case <-ctx.Done():
+			// server failed to start, error is reported by Wait
+		}
+		return nil
 	})
 
 	if err := g.Wait(); err != nil {
-		log.Fatal(err)
+		logger.Errorf("Server failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+// loadConfig loads settings from environment and CONFIG_FILE and applies settings of logging and timeouts.
+// Exits if file can not be read or server settings are invalid. Problems of dialogs settings disable dialogs only.
+func loadConfig() *config.Config {
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		logger.Errorf("Cannot load config: %v", err)
+		os.Exit(1)
+	}
+	logging.Configure(cfg.Logging.Level, cfg.Logging.Levels, cfg.Logging.UserText)
+	shutdownTimeout = cfg.Server.ShutdownTimeout()
+	responseTimeout = cfg.Server.ResponseTimeout()
+	return cfg
+}
+
+// reportConfig logs effective settings with their sources. Secrets are masked.
+func reportConfig(cfg *config.Config) {
+	settings := map[string]string{}
+	for _, s := range cfg.Report() {
+		settings[s.Env] = fmt.Sprintf("%q (%s)", s.Value, s.Source)
+	}
+	logger.With("settings", settings).Infof("Effective config")
+}
+
+// initDialogs inits dialogs and returns working ones. Dialogs failed to init are added to disabled with init errors.
+func initDialogs(dialogs []Dialog, disabled map[Dialog]error, deps *common.Dependencies) []Dialog {
+	var initialized []Dialog
+	for _, v := range dialogs {
+		if err := v.Init(deps); err != nil {
+			logger.Errorf("Dialog %s is disabled, init failed: %v", v.GetPath(), err)
+			disabled[v] = err
+			continue
+		}
+		initialized = append(initialized, v)
+	}
+	return initialized
+}
+
+// newHealthChecker creates checker of dialogs health, caching results for health check interval. Dialogs are checked
+// every interval in background too, as checks restore broken connections to DBs.
+func newHealthChecker(dialogs []Dialog, disabled map[Dialog]error, deps *common.Dependencies) *health.Checker {
+	checker := health.NewChecker(deps.Config.Server.HealthCheckInterval())
+	for _, v := range buildOrder(dialogs, disabled) {
+		if err, ok := disabled[v]; ok {
+			checker.AddDisabled(dialogName(v), err)
+		} else {
+			checker.Add(dialogName(v), v.Health)
+		}
+	}
+	return checker
+}
+
+// newStatistics creates statistics aggregator saving statistics to MongoDB every flush interval.
+// Statistics are kept in common DB, if they have no own DB, and in memory only if DB is not configured or not available.
+func newStatistics(deps *common.Dependencies) *statistics.Aggregator {
+	settings := deps.Config.Statistics
+	connectionString, database := settings.MongoConnection, settings.DatabaseName
+	if connectionString == "" {
+		connectionString = deps.Config.Common.MongoConnection
+	}
+	if database == "" {
+		database = deps.Config.Common.DatabaseName
+	}
+	connection, err := deps.Mongo.Get(connectionString, database)
+	if err != nil {
+		logger.Warnf("Statistics will be kept in memory only: %v", err)
+		return statistics.NewAggregator(nil)
 	}
+	stats := statistics.NewAggregator(statistics.NewMongoStore(connection, "statistics"))
+	stats.Start(settings.FlushInterval())
+	return stats
 }
 
-func handler() http.Handler {
+// newPager returns pager of dialog implementing PagedDialog, nil for other dialogs.
+func newPager(dialog Dialog, deps *common.Dependencies) *reply.Pager {
+	pagedDialog, ok := dialog.(PagedDialog)
+	if !ok {
+		return nil
+	}
+	return reply.NewPager(deps.SessionStore("pages_"+path.Base(dialog.GetPath())), pagedDialog.PageSize())
+}
+
+// newRecorder creates recorder of requests to dialogs, writing to file of recorder settings. Recording is disabled if file is not configured.
+// User ids are replaced with pseudonyms salted with salt of recorder settings, texts are hashed unless they are kept by settings.
+func newRecorder(deps *common.Dependencies) *recorder.Recorder {
+	file := deps.Config.Recorder.File
+	if file == "" {
+		return nil
+	}
+	rec, err := recorder.NewRecorder(file, deps.Config.Recorder.Salt, deps.Config.Recorder.KeepText)
+	if err != nil {
+		logger.Warnf("Requests will not be recorded: %v", err)
+		return nil
+	}
+	logger.Infof("Recording requests to %s", file)
+	return rec
+}
+
+// buildOrder returns working and disabled dialogs sorted by path.
+func buildOrder(dialogs []Dialog, disabled map[Dialog]error) []Dialog {
+	all := append([]Dialog{}, dialogs...)
+	for v := range disabled {
+		all = append(all, v)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].GetPath() < all[j].GetPath()
+	})
+	return all
+}
+
+// dialogName returns short name of dialog used in service endpoints, the last element of dialog path.
+func dialogName(dialog Dialog) string {
+	return path.Base(dialog.GetPath())
+}
+
+// shutdown stops accepting requests, waits for in-flight handlers and cron jobs and closes DB connections.
+// All steps share one deadline, as Heroku kills the process 30 seconds after SIGTERM.
+func shutdown(server *http.Server, dialogs []Dialog, stats *statistics.Aggregator, deps *common.Dependencies) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Errorf("Server is not stopped gracefully: %v", err)
+	}
+	var wg sync.WaitGroup
+	for _, v := range dialogs {
+		wg.Add(1)
+		go func(dialog Dialog) {
+			defer wg.Done()
+			if err := dialog.Close(ctx); err != nil {
+				logger.Errorf("Dialog %s is not stopped gracefully: %v", dialog.GetPath(), err)
+			}
+		}(v)
+	}
+	wg.Wait()
+	if err := stats.Close(ctx); err != nil {
+		logger.Errorf("Statistics are not saved: %v", err)
+	}
+	deps.Close()
+	logger.Infof("Server stopped")
+}
+
+// handler builds routes of dialogs and service endpoints. Statistics endpoints require `Authorization: Bearer <statistics token>`.
+func handler(dialogs []Dialog, checker *health.Checker, stats *statistics.Aggregator, rec *recorder.Recorder, deps *common.Dependencies) http.Handler {
+	cfg := deps.Config
+	statisticsToken := cfg.Statistics.Token
 	r := mux.NewRouter()
 	handler := common.Handler()
 
-	dialogs := buildHandlers()
-
 	for _, v := range dialogs {
+		if v.GetSkillID() == "" {
+			logger.Warnf("Skill id is not configured for %s, requests of any skill will be accepted", v.GetPath())
+		}
 		r.Handle(v.GetPath(),
-			handlers.LoggingHandler(
-				os.Stdout,
-				handler(handleRequest(v.HandleRequest()))),
+			metrics.Instrument(v.GetPath(),
+				logging.AccessHandler(
+					handler(handleRequest(v, newPager(v, deps), auth.ForSkill(v.GetSkillID(), cfg.Auth), stats, rec)))),
 		).Methods("POST", "OPTIONS")
 
 		v.ApiHandlers(r)
 	}
 
 	r.Handle("/health",
-		handlers.LoggingHandler(
-			os.Stdout,
-			handler(handleHealthRequest(dialogs))),
+		logging.AccessHandler(
+			handler(handleHealthRequest(checker))),
 	).Methods("GET")
 
+	r.Handle("/health/live",
+		logging.AccessHandler(
+			handler(handleLiveRequest())),
+	).Methods("GET")
+
+	r.Handle("/health/ready",
+		logging.AccessHandler(
+			handler(handleReadyRequest(checker))),
+	).Methods("GET")
+
+	r.Handle("/health/{dialog}",
+		logging.AccessHandler(
+			handler(handleDialogHealthRequest(checker))),
+	).Methods("GET")
+
+	r.Handle("/metrics",
+		handler(metrics.Handler(metrics.Default)),
+	).Methods("GET")
+
+	if statisticsToken == "" {
+		logger.Warnf("Statistics token is not configured, statistics endpoints will reject all requests")
+	}
 	r.Handle("/statistics",
-		handlers.LoggingHandler(
-			os.Stdout,
-			handler(handleStatisticsRequest())),
+		logging.AccessHandler(
+			auth.Bearer(statisticsToken, handler(handleStatisticsRequest(stats)))),
+	).Methods("GET")
+
+	r.Handle("/statistics/export",
+		logging.AccessHandler(
+			auth.Bearer(statisticsToken, handler(handleExportRequest(dialogs, stats)))),
+	).Methods("GET")
+
+	r.Handle("/statistics/{dialog}",
+		logging.AccessHandler(
+			auth.Bearer(statisticsToken, handler(handleSeriesRequest(dialogs, stats)))),
 	).Methods("GET")
 
 	return JsonContentType(handlers.CompressHandler(r))
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"yandex-dialogs/config"
+	"yandex-dialogs/registry"
+)
+
+func paths(dialogs []Dialog) []string {
+	var result []string
+	for _, dialog := range dialogs {
+		result = append(result, dialog.GetPath())
+	}
+	return result
+}
+
+func TestAllRegisteredDialogsAreMountedByDefault(t *testing.T) {
+	dialogs, disabled, err := buildHandlers(config.New(map[string]string{"DIALOGS": "", "MASHA_ENABLED": "false"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dialogs)+len(disabled) != len(registry.Names())-1 {
+		t.Errorf("expected all dialogs except masha, got %v and disabled %v", paths(dialogs), disabled)
+	}
+	for _, path := range paths(buildOrder(dialogs, disabled)) {
+		if path == "/api/dialogs/masha" {
+			t.Error("masha is disabled by config")
+		}
+	}
+}
+
+func TestMountsOfConfig(t *testing.T) {
+	dialogs, disabled, err := buildHandlers(config.New(map[string]string{
+		"DIALOGS":    "good-morning,good-morning=/api/dialogs/morning,voice-mail",
+		"MAIL_STORE": "mongo", "MONGO_CONNECTION": "",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(paths(dialogs), ","); got != "/api/dialogs/good-morning,/api/dialogs/morning" {
+		t.Errorf("unexpected mounted dialogs %s", got)
+	}
+	if len(disabled) != 1 {
+		t.Errorf("expected voice mail without DB to be disabled, got %v", disabled)
+	}
+}
+
+func TestInvalidMounts(t *testing.T) {
+	for _, dialogs := range []string{"unknown", "good-morning,good-morning", "masha=/api/dialogs/x,stalker=/api/dialogs/x"} {
+		if _, _, err := buildHandlers(config.New(map[string]string{"DIALOGS": dialogs})); err == nil {
+			t.Errorf("expected error for mounts %s", dialogs)
+		}
+	}
+	cfg := config.New(map[string]string{"DIALOGS": "masha"})
+	cfg.Mounts[0].Options = map[string]string{"timeout_ms": "fast"}
+	if _, _, err := buildHandlers(cfg); err == nil || !strings.Contains(err.Error(), "timeout_ms") {
+		t.Errorf("expected error for invalid option, got %v", err)
+	}
+}
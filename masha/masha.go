@@ -2,18 +2,24 @@ package masha
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/azzzak/alice"
 	"github.com/gorilla/mux"
 	"io/ioutil"
-	"log"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 	"yandex-dialogs/common"
+	"yandex-dialogs/health"
+	"yandex-dialogs/intents"
+	"yandex-dialogs/later"
+	"yandex-dialogs/logging"
+	"yandex-dialogs/registry"
+	"yandex-dialogs/statistics"
 )
 
 var helloSentences = [...]string{"Привет", "Добрый день", "Здравствуйте"}
@@ -23,54 +29,111 @@ var bySentences = [...]string{"Хорошо поболтали! Запиши м
 
 var errorSentences = [...]string{"Даже не знаю, спроси что нибудь ещё", "Что-то не могу сообразить, давай поменяем тему", "Не могу сообразить, спроси ещё что нибудь", "Даже не знаю, спроси по другому"}
 
+var thinkSentences = [...]string{"Хм, дай подумать... А пока спроси что-нибудь ещё", "Надо подумать, напомни мне через минутку", "Сложный вопрос, дай мне время"}
+
 var failSentences = [...]string{"Что-то мне не хорошо, попробуй зайти попозже", "Что-то не могу нормально соображать, давай притормозим общение на пару часиков", "Я плохо себя чувствую, напиши мне позднее"}
 
-var exitWords = []string{"отмена", "хватит", "выйти", "закончи", "закрыть", "выход"}
+var exitWords = []string{"отмена", "хватит", "выйти", "закончи*", "закрыть", "выход"}
+var exitExactWords = []string{"все"}
+var helpWords = []string{"ты умеешь", "ты можешь"}
+var helpExactWords = []string{"помощь"}
 
-var mongoConnection = common.GetEnv("MONGO_CONNECTION", "")
-var databaseName = common.GetEnv("DATABASE_NAME", "voice-mail")
+const (
+	exitCommand = "exit"
+	helpCommand = "help"
+)
 
-var stupidMode = common.GetEnv("MASHA_STUPID_MODE", "false")
-var stupidUrl = common.GetEnv("MASHA_STUPID_URL", "")
+var commands = intents.NewMatcher(
+	intents.Intent{Name: exitCommand, Phrases: exitWords, Priority: 20},
+	intents.Intent{Name: exitCommand, Phrases: exitExactWords, Priority: 20, Exact: true},
+	intents.Intent{Name: helpCommand, Phrases: helpWords, Priority: 10},
+	intents.Intent{Name: helpCommand, Phrases: helpExactWords, Priority: 10, Exact: true},
+)
 
 type Masha struct {
+	path       string
+	skillID    string
 	mashaUrl   string
-	httpClient http.Client
+	stupidMode bool
+	stupidUrl  string
+	timeout    time.Duration
+	httpClient *http.Client
+	answers    *later.Answers
 }
 
-func (v Masha) ApiHandlers(router *mux.Router) {
+func (v *Masha) ApiHandlers(router *mux.Router) {
 	// no implementation here
 }
 
-func NewMasha(timeout time.Duration) Masha {
+const defaultPath = "/api/dialogs/masha"
+
+func init() {
+	registry.Register("masha", defaultPath, func(path string, options registry.Options) (registry.Dialog, error) {
+		timeout, err := options.Int("timeout_ms", 10000)
+		if err != nil {
+			return nil, err
+		}
+		masha := NewMasha(time.Duration(timeout))
+		masha.path = path
+		return masha, nil
+	})
+}
+
+// NewMasha creates dialog, which waits for answer of Masha API not longer than timeout in milliseconds.
+// Answers taking longer than time to respond to Alice are delivered with the next response.
+func NewMasha(timeout time.Duration) *Masha {
+	return &Masha{path: defaultPath, timeout: time.Millisecond * timeout}
+}
+
+func (v *Masha) Init(deps *common.Dependencies) error {
 	rand.Seed(time.Now().Unix())
+	settings := deps.Config.Dialogs.Masha
+	v.skillID = settings.SkillID
+	v.mashaUrl = settings.URL
+	v.stupidMode = settings.StupidMode
+	v.stupidUrl = settings.StupidURL
+	v.httpClient = deps.UpstreamClient("masha", v.timeout)
+	v.answers = later.NewAnswers(10 * time.Minute)
+	return nil
+}
 
-	masha := Masha{
-		mashaUrl:   common.GetEnv("MASHA_URL", ""),
-		httpClient: http.Client{Timeout: time.Millisecond * timeout},
-	}
-	return masha
+func (v *Masha) Close(ctx context.Context) error {
+	return nil
+}
+
+func (v *Masha) GetPath() string {
+	return v.path
 }
 
-func (v Masha) GetPath() string {
-	return "/api/dialogs/masha"
+func (v *Masha) GetSkillID() string {
+	return v.skillID
 }
 
-func (v Masha) Health() (result bool, message string) {
-	if _, err := v.GetAnswer("health", "Привет"); err != nil {
-		return false, fmt.Sprintf("Exception occurred when getting message from API: %v", err)
+// Health reports state of Masha API by the last answer of it, without asking it.
+func (v *Masha) Health() (result bool, message string) {
+	if v.stupidMode && v.stupidUrl == "" || !v.stupidMode && v.mashaUrl == "" {
+		return false, "Masha API URL is not configured"
 	}
-	return true, "OK"
+	return health.Upstream("masha")
 }
 
-func (v Masha) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+func (v *Masha) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	h := v.HandleRequestContext()
 	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		return h(context.Background(), request, response)
+	}
+}
+
+func (v *Masha) HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
 
 		text := request.Text()
+		command := commands.Match(text)
+		statistics.ReportCommand(ctx, command.Name)
 		if request.Session.New == true {
 			answer := helloSentences[rand.Intn(len(helloSentences))]
 			quest := helloAnswers[rand.Intn(len(helloAnswers))]
-			if stupidMode == "true" {
+			if v.stupidMode {
 				response.Text(fmt.Sprintf("Привет, друг! Со мной случилась беда: я не могу вспомнить всё, чему обучалась на протяжении этих лет. Прошу, не обижайся на меня, если я буду тупить или отвечать как двухлетний ребенок, я постараюсь вернуть свою память... \n- %s! А пока, Давай поболтаем?", answer))
 			} else {
 				response.Text(fmt.Sprintf("Внимание, диалог может содержать взрослый и непристойный контент, если Вам нет восемнадцати лет, пожалуйста, закройте навык!. \n- %s! Давай поболтаем?", answer))
@@ -79,7 +142,7 @@ func (v Masha) HandleRequest() func(request *alice.Request, response *alice.Resp
 			response.Button("Написать Маше на почту", "https://dialogs.yandex.ru/store/skills/eacbce8f-govoryashaya-po", false)
 			response.Button(quest, "", true)
 			return response
-		} else if strings.EqualFold(text, "всё") || strings.EqualFold(text, "все") || containsIgnoreCase(text, exitWords) {
+		} else if command.Name == exitCommand {
 			answer := bySentences[rand.Intn(len(bySentences))]
 			response.Text(answer)
 			if strings.Contains(answer, "8-8-0-0") {
@@ -90,25 +153,46 @@ func (v Masha) HandleRequest() func(request *alice.Request, response *alice.Resp
 			response.Button("Закончить", "", true)
 			response.Response.EndSession = true
 			return response
-		} else if strings.EqualFold(text, "помощь") || strings.EqualFold(text, "что ты умеешь") || strings.Contains(text, "ты умеешь") || strings.Contains(text, "ты можешь") {
+		} else if command.Name == helpCommand {
 			response.Text("Меня зовут Маша. Я интерактивный бот собеседеник, обучаюсь на разговорах с людьми и каждый день должна становиться умнее. Но практика показывает, что я только деградирую... Просто спроси меня что нибудь, и давай поболтаем. Если устанешь от меня, просто скажи - всё или - хватит болтать. Кстати, мой номер в навыке Говорящая Почта - 8-8-0-0, готова общаться с Вами и там.")
 			response.Button("Подбодрить Машу", "https://dialogs.yandex.ru/store/skills/67b197f0-nedetskie-razgovory", false)
 			response.Button("Узнать про коронавирус", "https://dialogs.yandex.ru/store/skills/d5087c0d-hroniki-koronavirusa", false)
 			return response
 		}
-		if stupidMode == "true" {
-			answer, _ := v.GetStupidAnswer(request.Session.SessionID, text)
-			response.Text(answer)
-		} else {
-			answer, _ := v.GetAnswer(request.Session.UserID, text)
-			response.Text(answer)
+		// request is reused after response is sent, but late answer is still being fetched
+		userID, sessionID := request.Session.UserID, request.Session.SessionID
+		answer, inTime, _ := v.answers.Get(ctx, sessionID, func(ctx context.Context) (string, error) {
+			if v.stupidMode {
+				return v.GetStupidAnswerContext(ctx, sessionID, text)
+			}
+			return v.GetAnswerContext(ctx, userID, text)
+		})
+		if !inTime {
+			answer = thinkSentences[rand.Intn(len(thinkSentences))]
+		}
+		if lateAnswer, ok := v.answers.Take(sessionID); ok {
+			answer = later.Reminder + lateAnswer + "\n- " + answer
 		}
+		response.Text(answer)
 		return response
 	}
 }
 
-func (v Masha) GetAnswer(userID string, text string) (string, error) {
-	resp, err := v.httpClient.PostForm(
+// Apology answers in character of Masha when handling of request fails.
+func (v *Masha) Apology(request *alice.Request, response *alice.Response) *alice.Response {
+	response.Text(failSentences[rand.Intn(len(failSentences))])
+	response.Button("Закончить", "", true)
+	return response
+}
+
+func (v *Masha) GetAnswer(userID string, text string) (string, error) {
+	return v.GetAnswerContext(context.Background(), userID, text)
+}
+
+// GetAnswerContext gets answer of Masha API, waiting for it until ctx is done.
+func (v *Masha) GetAnswerContext(ctx context.Context, userID string, text string) (string, error) {
+	logger := logging.FromContext(ctx, "masha")
+	resp, err := common.PostForm(ctx, v.httpClient,
 		v.mashaUrl,
 		url.Values{
 			"chatId":  {userID},
@@ -116,25 +200,31 @@ func (v Masha) GetAnswer(userID string, text string) (string, error) {
 		},
 	)
 	if err != nil {
-		log.Print(err)
+		logger.Errorf("Cannot get answer of Masha API: %v", err)
 		return errorSentences[rand.Intn(len(errorSentences))], err
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Print(err)
+		logger.Errorf("Cannot get answer of Masha API: %v", err)
 		return errorSentences[rand.Intn(len(errorSentences))], err
 	}
 	bodyString := string(bodyBytes)
 	if bodyString == "" {
-		log.Print("fail, empty message")
+		logger.Warnf("Masha API answered with empty message")
 		return failSentences[rand.Intn(len(failSentences))], nil
 	}
 	return bodyString, nil
 }
 
-func (v Masha) GetStupidAnswer(userID string, text string) (string, error) {
+func (v *Masha) GetStupidAnswer(userID string, text string) (string, error) {
+	return v.GetStupidAnswerContext(context.Background(), userID, text)
+}
+
+// GetStupidAnswerContext gets answer of stupid Masha API, waiting for it until ctx is done.
+func (v *Masha) GetStupidAnswerContext(ctx context.Context, userID string, text string) (string, error) {
+	logger := logging.FromContext(ctx, "masha")
 	body := map[string]interface{}{}
 
 	body["uid"] = userID
@@ -143,46 +233,37 @@ func (v Masha) GetStupidAnswer(userID string, text string) (string, error) {
 
 	content, err := json.Marshal(body)
 	if err != nil {
-		log.Print(err)
+		logger.Errorf("Cannot get answer of stupid Masha API: %v", err)
 		return errorSentences[rand.Intn(len(errorSentences))], err
 	}
 
-	resp, err := v.httpClient.Post(
-		stupidUrl,
+	resp, err := common.Post(ctx, v.httpClient,
+		v.stupidUrl,
 		"application/json",
 		bytes.NewBuffer(content),
 	)
 
 	if err != nil {
-		log.Print(err)
+		logger.Errorf("Cannot get answer of stupid Masha API: %v", err)
 		return errorSentences[rand.Intn(len(errorSentences))], err
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Print(err)
+		logger.Errorf("Cannot get answer of stupid Masha API: %v", err)
 		return errorSentences[rand.Intn(len(errorSentences))], err
 	}
 	err = json.Unmarshal(bodyBytes, &body)
 	if err != nil {
-		log.Print(err)
+		logger.Errorf("Cannot get answer of stupid Masha API: %v", err)
 		return errorSentences[rand.Intn(len(errorSentences))], err
 	}
 
-	bodyString := body["text"]
+	bodyString, _ := body["text"].(string)
 	if bodyString == "" {
-		log.Print("fail, empty message")
+		logger.Warnf("stupid Masha API answered with empty message")
 		return failSentences[rand.Intn(len(failSentences))], nil
 	}
-	return bodyString.(string), nil
-}
-
-func containsIgnoreCase(message string, wordsToCheck []string) bool {
-	for _, word := range wordsToCheck {
-		if strings.Contains(strings.ToUpper(message), strings.ToUpper(word)) {
-			return true
-		}
-	}
-	return false
+	return bodyString, nil
 }
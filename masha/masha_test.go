@@ -0,0 +1,97 @@
+package masha
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yandex-dialogs/harness"
+	"yandex-dialogs/later"
+	"yandex-dialogs/simulator"
+)
+
+// newFakeMasha starts server answering like Masha API, with the message repeated after `Ответ на: `.
+func newFakeMasha(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("chatId") == "" {
+			t.Errorf("chat id is not sent")
+		}
+		w.Write([]byte("Ответ на: " + r.PostFormValue("message")))
+	}))
+}
+
+func TestConversation(t *testing.T) {
+	server := newFakeMasha(t)
+	defer server.Close()
+	dialog := NewMasha(1000)
+	if err := dialog.Init(harness.NewDependencies(map[string]string{"MASHA_URL": server.URL, "MASHA_STUPID_MODE": "false"})); err != nil {
+		t.Fatal(err)
+	}
+
+	harness.NewConversation(t, dialog, "user").Run(
+		harness.Step{Say: "", Text: []string{"Давай поболтаем?"}},
+		harness.Step{Say: "Как дела?", Text: []string{"Ответ на: Как дела?"}},
+		harness.Step{Say: "помощь", Text: []string{"Меня зовут Маша"}},
+		harness.Step{Say: "хватит", EndSession: true},
+	)
+}
+
+func TestEmptyAnswer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	dialog := NewMasha(1000)
+	if err := dialog.Init(harness.NewDependencies(map[string]string{"MASHA_URL": server.URL, "MASHA_STUPID_MODE": "false"})); err != nil {
+		t.Fatal(err)
+	}
+
+	conversation := harness.NewConversation(t, dialog, "user")
+	conversation.Say("")
+	response := conversation.Say("Привет")
+	if !contains(failSentences[:], response.Response.Text) {
+		t.Errorf("expected fail sentence, got %q", response.Response.Text)
+	}
+}
+
+func contains(sentences []string, text string) bool {
+	for _, s := range sentences {
+		if s == text {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLateAnswer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("message") == "Сложный вопрос" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Write([]byte("Ответ на: " + r.PostFormValue("message")))
+	}))
+	defer server.Close()
+	dialog := NewMasha(1000)
+	if err := dialog.Init(harness.NewDependencies(map[string]string{"MASHA_URL": server.URL, "MASHA_STUPID_MODE": "false"})); err != nil {
+		t.Fatal(err)
+	}
+	handle := dialog.HandleRequestContext()
+	user := simulator.NewUser("user")
+	say := func(text string) string {
+		ctx, cancel := context.WithTimeout(context.Background(), later.Margin+100*time.Millisecond)
+		defer cancel()
+		request := user.Request(text)
+		return handle(ctx, request, simulator.NewResponse(request)).Response.Text
+	}
+
+	say("")
+	if answer := say("Сложный вопрос"); !contains(thinkSentences[:], answer) {
+		t.Fatalf("expected dialog to think, got %q", answer)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if answer := say("Привет"); answer != later.Reminder+"Ответ на: Сложный вопрос\n- Ответ на: Привет" {
+		t.Errorf("expected late answer, got %q", answer)
+	}
+	if answer := say("Пока"); answer != "Ответ на: Пока" {
+		t.Errorf("expected late answer to be delivered once, got %q", answer)
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Default is a registry of all metrics of the server, exposed on `/metrics`.
+var Default = NewRegistry()
+
+var (
+	Requests = Default.NewCounterVec("dialogs_requests_total",
+		"Number of handled requests by dialog path and HTTP status code.", "path", "code")
+	RequestDuration = Default.NewHistogramVec("dialogs_request_duration_seconds",
+		"Time of handling requests by dialog path.", DefBuckets, "path")
+	ResponseSize = Default.NewHistogramVec("dialogs_response_size_bytes",
+		"Size of response bodies by dialog path.", SizeBuckets, "path")
+	PanicsRecovered = Default.NewCounterVec("dialogs_panics_recovered_total",
+		"Number of panics recovered by dialog path.", "path")
+	AuthRejections = Default.NewCounterVec("dialogs_auth_rejections_total",
+		"Number of requests rejected by authentication by dialog path and reason.", "path", "reason")
+	ResponseTimeouts = Default.NewCounterVec("dialogs_response_timeouts_total",
+		"Number of requests answered with fallback response, as dialog did not respond in time, by dialog path.", "path")
+	UpstreamDuration = Default.NewHistogramVec("dialogs_upstream_request_duration_seconds",
+		"Time of requests to external APIs by upstream.", DefBuckets, "upstream")
+	UpstreamErrors = Default.NewCounterVec("dialogs_upstream_errors_total",
+		"Number of failed requests to external APIs by upstream.", "upstream")
+	MongoDuration = Default.NewHistogramVec("dialogs_mongo_operation_duration_seconds",
+		"Time of MongoDB operations by collection and operation.", DefBuckets, "collection", "operation")
+	CronDuration = Default.NewHistogramVec("dialogs_cron_job_duration_seconds",
+		"Time of cron job runs by job.", []float64{.1, .5, 1, 5, 10, 30, 60, 300}, "job")
+	VoiceMailQueueDepth = Default.NewGaugeVec("dialogs_voice_mail_queue_depth",
+		"Number of messages waiting for bot answer by bot number, measured on each bot run.", "number")
+)
+
+// ObserveUpstream records duration of request to upstream started at start. Error is counted if err is not nil.
+// HTTP clients are instrumented by Transport, so it is needed only for other kinds of upstreams.
+func ObserveUpstream(upstream string, start time.Time, err error) {
+	latency := time.Since(start)
+	UpstreamDuration.Observe(latency.Seconds(), upstream)
+	if err != nil {
+		UpstreamErrors.Inc(upstream)
+	}
+	upstreams.Lock()
+	upstreams.states[upstream] = UpstreamState{At: time.Now(), Latency: latency, Err: err}
+	upstreams.Unlock()
+}
+
+// UpstreamState is outcome of the last request to upstream.
+type UpstreamState struct {
+	At      time.Time
+	Latency time.Duration
+	Err     error
+}
+
+var upstreams = struct {
+	sync.Mutex
+	states map[string]UpstreamState
+}{states: map[string]UpstreamState{}}
+
+// LastUpstream returns outcome of the last request to upstream. Returns false if there were no requests to it yet.
+func LastUpstream(upstream string) (UpstreamState, bool) {
+	upstreams.Lock()
+	defer upstreams.Unlock()
+	state, ok := upstreams.states[upstream]
+	return state, ok
+}
+
+// ObserveMongo records duration of MongoDB operation started at start.
+// Usage: `defer metrics.ObserveMongo("users", "find", time.Now())`.
+func ObserveMongo(collection, operation string, start time.Time) {
+	MongoDuration.Observe(time.Since(start).Seconds(), collection, operation)
+}
+
+// ObserveCron records duration of cron job run started at start.
+// Usage: `defer metrics.ObserveCron("masha_bot", time.Now())`.
+func ObserveCron(job string, start time.Time) {
+	CronDuration.Observe(time.Since(start).Seconds(), job)
+}
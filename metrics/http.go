@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"yandex-dialogs/logging"
+)
+
+// Handler serves metrics of registry in Prometheus text exposition format.
+func Handler(registry *Registry) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if err := registry.Write(w); err != nil {
+			logging.For("metrics").Warnf("Cannot write metrics: %v", err)
+		}
+	}
+}
+
+// Instrument counts requests to handler by status code and records their duration and response size under path label.
+func Instrument(path string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(recorder, r)
+		Requests.Inc(path, strconv.Itoa(recorder.status))
+		RequestDuration.Observe(time.Since(start).Seconds(), path)
+		ResponseSize.Observe(float64(recorder.size), path)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Transport records duration of requests made through base transport under upstream label.
+// Request is counted as failed if it returns error or 5xx status code.
+func Transport(upstream string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := base.RoundTrip(r)
+		if err == nil && resp.StatusCode >= 500 {
+			ObserveUpstream(upstream, start, errors.New(resp.Status))
+		} else {
+			ObserveUpstream(upstream, start, err)
+		}
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
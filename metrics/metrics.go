@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are default buckets of histograms measuring duration in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets are buckets of histograms measuring size in bytes.
+var SizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536}
+
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry keeps metrics and writes them in Prometheus text exposition format.
+type Registry struct {
+	mux     sync.Mutex
+	metrics []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, m := range r.metrics {
+		if m.name() == c.name() {
+			panic("metric " + c.name() + " is already registered")
+		}
+	}
+	r.metrics = append(r.metrics, c)
+	sort.Slice(r.metrics, func(i, j int) bool {
+		return r.metrics[i].name() < r.metrics[j].name()
+	})
+}
+
+// Write writes all metrics sorted by name in Prometheus text exposition format version 0.0.4.
+func (r *Registry) Write(w io.Writer) error {
+	r.mux.Lock()
+	metrics := append([]collector{}, r.metrics...)
+	r.mux.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	return buf.Flush()
+}
+
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+func (d desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", d.metricName, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (d desc) writeHeader(w *bufio.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metricName, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metricName, metricType)
+}
+
+// writeSample writes sample line. Extra label, like `le` of histogram bucket, is added after labels of metric.
+func (d desc) writeSample(w *bufio.Writer, suffix string, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(d.metricName)
+	w.WriteString(suffix)
+	var pairs []string
+	for i, label := range d.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(labelValues[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// sortedKeys returns keys of series in order of their label values.
+func sortedKeys(keys map[string][]string) []string {
+	result := make([]string, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// CounterVec is a counter partitioned by labels. Counter only grows.
+type CounterVec struct {
+	desc
+	mux    sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, labels}, values: map[string]float64{}, labels: map[string][]string{}}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("counter " + c.metricName + " cannot decrease")
+	}
+	key := c.key(labelValues)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.values[key] += value
+	c.labels[key] = labelValues
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.writeHeader(w, "counter")
+	for _, key := range sortedKeys(c.labels) {
+		c.writeSample(w, "", c.labels[key], "", "", c.values[key])
+	}
+}
+
+// GaugeVec is a value partitioned by labels, which can go up and down.
+type GaugeVec struct {
+	desc
+	mux    sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{desc: desc{name, help, labels}, values: map[string]float64{}, labels: map[string][]string{}}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.values[key] = value
+	g.labels[key] = labelValues
+}
+
+func (g *GaugeVec) Add(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.values[key] += value
+	g.labels[key] = labelValues
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.writeHeader(w, "gauge")
+	for _, key := range sortedKeys(g.labels) {
+		g.writeSample(w, "", g.labels[key], "", "", g.values[key])
+	}
+}
+
+// HistogramVec counts observed values in buckets, partitioned by labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mux     sync.Mutex
+	series  map[string]*histogram
+	labels  map[string][]string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{desc: desc{name, help, labels}, buckets: buckets, series: map[string]*histogram{}, labels: map[string][]string{}}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+		h.labels[key] = labelValues
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(h.labels) {
+		s, labelValues := h.series[key], h.labels[key]
+		for i, bound := range h.buckets {
+			h.writeSample(w, "_bucket", labelValues, "le", formatFloat(bound), float64(s.counts[i]))
+		}
+		h.writeSample(w, "_bucket", labelValues, "le", "+Inf", float64(s.count))
+		h.writeSample(w, "_sum", labelValues, "", "", s.sum)
+		h.writeSample(w, "_count", labelValues, "", "", float64(s.count))
+	}
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+type family struct {
+	help    string
+	typ     string
+	samples []sample
+}
+
+var sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(?:\{(.*)\})? (\S+)$`)
+
+// parse reads Prometheus text exposition format and fails on any line not conforming to it.
+func parse(t *testing.T, text string) map[string]*family {
+	families := map[string]*family{}
+	get := func(name string) *family {
+		if f, ok := families[name]; ok {
+			return f
+		}
+		f := &family{}
+		families[name] = f
+		return f
+	}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			parts := strings.SplitN(strings.TrimPrefix(line, "# HELP "), " ", 2)
+			get(parts[0]).help = parts[1]
+		case strings.HasPrefix(line, "# TYPE "):
+			parts := strings.SplitN(strings.TrimPrefix(line, "# TYPE "), " ", 2)
+			switch parts[1] {
+			case "counter", "gauge", "histogram":
+			default:
+				t.Fatalf("unknown type in line %q", line)
+			}
+			get(parts[0]).typ = parts[1]
+		default:
+			m := sampleLine.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("malformed line %q", line)
+			}
+			value, err := strconv.ParseFloat(m[3], 64)
+			if err != nil {
+				t.Fatalf("malformed value in line %q: %v", line, err)
+			}
+			name := m[1]
+			base := name
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if trimmed := strings.TrimSuffix(name, suffix); trimmed != name && families[trimmed] != nil && families[trimmed].typ == "histogram" {
+					base = trimmed
+				}
+			}
+			f, ok := families[base]
+			if !ok || f.typ == "" {
+				t.Fatalf("sample %q has no TYPE declared before it", line)
+			}
+			f.samples = append(f.samples, sample{name: name, labels: parseLabels(t, m[2]), value: value})
+		}
+	}
+	return families
+}
+
+func parseLabels(t *testing.T, text string) map[string]string {
+	labels := map[string]string{}
+	for len(text) > 0 {
+		eq := strings.Index(text, `="`)
+		if eq < 0 {
+			t.Fatalf("malformed labels %q", text)
+		}
+		name := text[:eq]
+		text = text[eq+2:]
+		var value strings.Builder
+		i := 0
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] == '\\' {
+				i++
+				switch text[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case '\\', '"':
+					value.WriteByte(text[i])
+				default:
+					t.Fatalf("unknown escape in labels %q", text)
+				}
+				continue
+			}
+			value.WriteByte(text[i])
+		}
+		if i == len(text) {
+			t.Fatalf("unterminated label value %q", text)
+		}
+		labels[name] = value.String()
+		text = strings.TrimPrefix(text[i+1:], ",")
+	}
+	return labels
+}
+
+func find(t *testing.T, f *family, name string, labels map[string]string) float64 {
+	for _, s := range f.samples {
+		if s.name == name && fmt.Sprint(s.labels) == fmt.Sprint(labels) {
+			return s.value
+		}
+	}
+	t.Fatalf("sample %s%v not found", name, labels)
+	return 0
+}
+
+func write(t *testing.T, r *Registry) string {
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWriteCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Number of requests.\nMultiline help.", "path")
+	depth := r.NewGaugeVec("queue_depth", "Depth of queue.", "queue")
+
+	requests.Inc("/api/a")
+	requests.Add(2, "/api/a")
+	requests.Inc(`/api/"quoted"\path` + "\n")
+	depth.Set(5, "8800")
+	depth.Add(-2, "8800")
+
+	families := parse(t, write(t, r))
+	if len(families) != 2 {
+		t.Fatalf("expected 2 families, got %d", len(families))
+	}
+	f := families["requests_total"]
+	if f.typ != "counter" || f.help != `Number of requests.\nMultiline help.` {
+		t.Errorf("unexpected header of requests_total: %q %q", f.typ, f.help)
+	}
+	if v := find(t, f, "requests_total", map[string]string{"path": "/api/a"}); v != 3 {
+		t.Errorf("expected 3 requests, got %v", v)
+	}
+	if v := find(t, f, "requests_total", map[string]string{"path": `/api/"quoted"\path` + "\n"}); v != 1 {
+		t.Errorf("expected 1 request with escaped path, got %v", v)
+	}
+	if v := find(t, families["queue_depth"], "queue_depth", map[string]string{"queue": "8800"}); v != 3 {
+		t.Errorf("expected depth 3, got %v", v)
+	}
+}
+
+func TestWriteHistogram(t *testing.T) {
+	r := NewRegistry()
+	duration := r.NewHistogramVec("duration_seconds", "Duration.", []float64{1, 0.1, 0.5}, "job")
+
+	for _, v := range []float64{0.05, 0.2, 0.7, 3} {
+		duration.Observe(v, "bot")
+	}
+
+	f := parse(t, write(t, r))["duration_seconds"]
+	if f.typ != "histogram" {
+		t.Fatalf("expected histogram, got %q", f.typ)
+	}
+	expected := map[string]float64{"0.1": 1, "0.5": 2, "1": 3, "+Inf": 4}
+	previous := -1.0
+	for _, s := range f.samples {
+		if s.name != "duration_seconds_bucket" {
+			continue
+		}
+		if s.value < previous {
+			t.Errorf("buckets are not cumulative: %v after %v", s.value, previous)
+		}
+		previous = s.value
+		if s.value != expected[s.labels["le"]] {
+			t.Errorf("bucket le=%s: expected %v, got %v", s.labels["le"], expected[s.labels["le"]], s.value)
+		}
+	}
+	if v := find(t, f, "duration_seconds_count", map[string]string{"job": "bot"}); v != 4 {
+		t.Errorf("expected count 4, got %v", v)
+	}
+	if v := find(t, f, "duration_seconds_sum", map[string]string{"job": "bot"}); v != 3.95 {
+		t.Errorf("expected sum 3.95, got %v", v)
+	}
+}
+
+func TestInstrumentAndHandler(t *testing.T) {
+	path := "/api/dialogs/test-instrument"
+	h := Instrument(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("forbidden"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, nil))
+
+	recorder := httptest.NewRecorder()
+	Handler(Default)(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	families := parse(t, recorder.Body.String())
+	if v := find(t, families["dialogs_requests_total"], "dialogs_requests_total", map[string]string{"path": path, "code": "403"}); v != 2 {
+		t.Errorf("expected 2 requests, got %v", v)
+	}
+	if v := find(t, families["dialogs_response_size_bytes"], "dialogs_response_size_bytes_sum", map[string]string{"path": path}); v != 18 {
+		t.Errorf("expected 18 bytes in total, got %v", v)
+	}
+	for _, name := range []string{"dialogs_panics_recovered_total", "dialogs_upstream_request_duration_seconds",
+		"dialogs_mongo_operation_duration_seconds", "dialogs_cron_job_duration_seconds", "dialogs_voice_mail_queue_depth"} {
+		if families[name] == nil {
+			t.Errorf("metric %s is not exposed", name)
+		}
+	}
+}
+
+func TestTransportRecordsLastUpstream(t *testing.T) {
+	upstream := "test-transport"
+	if _, ok := LastUpstream(upstream); ok {
+		t.Fatal("expected no state before requests")
+	}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: Transport(upstream, nil)}
+
+	for _, test := range []struct {
+		status int
+		failed bool
+	}{
+		{http.StatusBadGateway, true},
+		{http.StatusNotFound, false},
+		{http.StatusOK, false},
+	} {
+		status = test.status
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		state, ok := LastUpstream(upstream)
+		if !ok || (state.Err != nil) != test.failed || state.At.IsZero() {
+			t.Errorf("unexpected state %+v after status %d", state, test.status)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package nlu
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/azzzak/alice"
+	"math"
+	"sort"
+)
+
+const (
+	NumberType   = "YANDEX.NUMBER"
+	StringType   = "YANDEX.STRING"
+	GeoType      = "YANDEX.GEO"
+	DateTimeType = "YANDEX.DATETIME"
+	FioType      = "YANDEX.FIO"
+)
+
+// Handler handles request with recognized intent. Handler may return nil to pass the request to `HandleRequest` of dialog.
+// Context is context of request, like in `HandleRequestContext` of dialog.
+type Handler func(ctx context.Context, request *alice.Request, intent Intent, response *alice.Response) *alice.Response
+
+// Intents are intents, configured in skill console and recognized by Yandex in user phrase, by intent name.
+type Intents map[string]Intent
+
+type Intent struct {
+	Name  string          `json:"-"`
+	Slots map[string]Slot `json:"slots"`
+}
+
+type Slot struct {
+	Type   string          `json:"type"`
+	Value  json.RawMessage `json:"value"`
+	Tokens struct {
+		Start int `json:"start"`
+		End   int `json:"end"`
+	} `json:"tokens"`
+}
+
+type nluRequest struct {
+	Request struct {
+		NLU struct {
+			Intents Intents `json:"intents"`
+		} `json:"nlu"`
+	} `json:"request"`
+}
+
+// Parse reads intents from raw body of Alice request, as azzzak/alice v0.1.0 does not expose them.
+func Parse(body []byte) (Intents, error) {
+	request := &nluRequest{}
+	if err := json.Unmarshal(body, request); err != nil {
+		return nil, err
+	}
+	intents := request.Request.NLU.Intents
+	for name, intent := range intents {
+		intent.Name = name
+		intents[name] = intent
+	}
+	return intents, nil
+}
+
+// Names returns names of intents in alphabetical order.
+func (i Intents) Names() []string {
+	names := make([]string, 0, len(i))
+	for name := range i {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Slot returns slot by name. Returns false if slot is not filled.
+func (i Intent) Slot(name string) (Slot, bool) {
+	slot, ok := i.Slots[name]
+	if !ok || len(slot.Value) == 0 || string(slot.Value) == "null" {
+		return Slot{}, false
+	}
+	return slot, true
+}
+
+// AsString returns value of string slot. Returns false if slot value is not a string.
+func (s Slot) AsString() (string, bool) {
+	var value string
+	if err := json.Unmarshal(s.Value, &value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// AsInt returns value of YANDEX.NUMBER slot. Returns false if slot value is not an integer number.
+func (s Slot) AsInt() (int, bool) {
+	value, ok := s.AsFloat()
+	if !ok || value != math.Trunc(value) {
+		return 0, false
+	}
+	return int(value), true
+}
+
+// AsFloat returns value of YANDEX.NUMBER slot. Returns false if slot value is not a number.
+func (s Slot) AsFloat() (float64, bool) {
+	var value float64
+	if err := json.Unmarshal(s.Value, &value); err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// Decode decodes complex slot value, like YANDEX.GEO or YANDEX.FIO, into value.
+func (s Slot) Decode(value interface{}) bool {
+	return json.Unmarshal(s.Value, value) == nil
+}
@@ -0,0 +1,137 @@
+package nlu
+
+import (
+	"reflect"
+	"testing"
+)
+
+const body = `{
+  "request": {
+    "command": "напомни позвонить маме через 2 часа",
+    "nlu": {
+      "intents": {
+        "remind": {
+          "slots": {
+            "what": {"type": "YANDEX.STRING", "tokens": {"start": 1, "end": 3}, "value": "позвонить маме"},
+            "hours": {"type": "YANDEX.NUMBER", "tokens": {"start": 4, "end": 5}, "value": 2},
+            "where": {"type": "YANDEX.GEO", "value": {"city": "москва", "street": "тверская"}},
+            "empty": {"type": "YANDEX.STRING", "value": null}
+          }
+        },
+        "YANDEX.CONFIRM": {"slots": {}}
+      }
+    }
+  },
+  "version": "1.0"
+}`
+
+func TestParse(t *testing.T) {
+	intents, err := Parse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := intents.Names(); !reflect.DeepEqual(names, []string{"YANDEX.CONFIRM", "remind"}) {
+		t.Errorf("unexpected names %q", names)
+	}
+	if intents["remind"].Name != "remind" {
+		t.Errorf("expected name of intent, got %q", intents["remind"].Name)
+	}
+	slot, ok := intents["remind"].Slot("what")
+	if !ok || slot.Type != StringType || slot.Tokens.Start != 1 || slot.Tokens.End != 3 {
+		t.Errorf("unexpected slot %+v", slot)
+	}
+
+	tests := []struct {
+		body  string
+		names []string
+		err   bool
+	}{
+		{`{"request": {"command": "привет"}}`, []string{}, false},
+		{`{"request": {"nlu": {"tokens": ["привет"], "entities": []}}}`, []string{}, false},
+		{`{"request": {"nlu": {"intents": {}}}}`, []string{}, false},
+		{`{"request": {"nlu": {"intents": []}}}`, nil, true},
+		{`not json`, nil, true},
+	}
+	for _, test := range tests {
+		intents, err := Parse([]byte(test.body))
+		if (err != nil) != test.err {
+			t.Errorf("Parse(%s) error = %v, want error %v", test.body, err, test.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(intents.Names(), test.names) {
+			t.Errorf("Parse(%s) = %q, want %q", test.body, intents.Names(), test.names)
+		}
+	}
+}
+
+func TestSlot(t *testing.T) {
+	intents, _ := Parse([]byte(body))
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"what", true},
+		{"hours", true},
+		{"where", true},
+		{"empty", false},
+		{"missing", false},
+	}
+	for _, test := range tests {
+		if _, ok := intents["remind"].Slot(test.name); ok != test.ok {
+			t.Errorf("Slot(%q) ok = %v, want %v", test.name, ok, test.ok)
+		}
+	}
+	if _, ok := intents["YANDEX.CONFIRM"].Slot("what"); ok {
+		t.Error("expected no slot of intent without slots")
+	}
+}
+
+func TestValues(t *testing.T) {
+	tests := []struct {
+		value   string
+		str     string
+		strOK   bool
+		num     int
+		numOK   bool
+		fl      float64
+		floatOK bool
+	}{
+		{`"позвонить маме"`, "позвонить маме", true, 0, false, 0, false},
+		{`2`, "", false, 2, true, 2, true},
+		{`-15`, "", false, -15, true, -15, true},
+		{`0`, "", false, 0, true, 0, true},
+		{`2.5`, "", false, 0, false, 2.5, true},
+		{`1e3`, "", false, 1000, true, 1000, true},
+		{`"2"`, "2", true, 0, false, 0, false},
+		{`{"city": "москва"}`, "", false, 0, false, 0, false},
+	}
+	for _, test := range tests {
+		slot := Slot{Value: []byte(test.value)}
+		if str, ok := slot.AsString(); str != test.str || ok != test.strOK {
+			t.Errorf("AsString of %s = %q, %v, want %q, %v", test.value, str, ok, test.str, test.strOK)
+		}
+		if num, ok := slot.AsInt(); num != test.num || ok != test.numOK {
+			t.Errorf("AsInt of %s = %d, %v, want %d, %v", test.value, num, ok, test.num, test.numOK)
+		}
+		if fl, ok := slot.AsFloat(); fl != test.fl || ok != test.floatOK {
+			t.Errorf("AsFloat of %s = %v, %v, want %v, %v", test.value, fl, ok, test.fl, test.floatOK)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	intents, _ := Parse([]byte(body))
+	type geo struct {
+		City   string `json:"city"`
+		Street string `json:"street"`
+	}
+	slot, _ := intents["remind"].Slot("where")
+	value := geo{}
+	if !slot.Decode(&value) || value != (geo{City: "москва", Street: "тверская"}) {
+		t.Errorf("unexpected value %+v", value)
+	}
+	slot, _ = intents["remind"].Slot("hours")
+	if slot.Decode(&value) {
+		t.Error("expected number not to be decoded into struct")
+	}
+}
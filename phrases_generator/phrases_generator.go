@@ -1,80 +1,118 @@
 package phrases_generator
 
 import (
-	"fmt"
+	"context"
 	"github.com/azzzak/alice"
 	"github.com/gorilla/mux"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 	"yandex-dialogs/common"
+	"yandex-dialogs/health"
+	"yandex-dialogs/later"
+	"yandex-dialogs/logging"
+	"yandex-dialogs/registry"
+	"yandex-dialogs/statistics"
 )
 
-var client = http.Client{}
+var logger = logging.For("phrases_generator")
 
 type PhrasesGenerator struct {
-	states map[string]State
-	mux    sync.Mutex
-	apiUrl string
+	path       string
+	skillID    string
+	states     common.SessionStore
+	apiUrl     string
+	httpClient *http.Client
+	answers    *later.Answers
 }
 
-func (v PhrasesGenerator) ApiHandlers(router *mux.Router) {
+// thinkingText is answer when title is not generated in time. Title is delivered with the next response then.
+const thinkingText = "Я ещё придумываю заголовок. Скажите - ещё, чтобы его услышать."
+
+func (v *PhrasesGenerator) ApiHandlers(router *mux.Router) {
 	// no implementation here
 }
 
 type State struct {
-	action string
-	word   string
-	last   string
+	Action string `json:"action"`
+	Word   string `json:"word"`
+	Last   string `json:"last"`
 }
 
-func NewDialog() PhrasesGenerator {
-	return PhrasesGenerator{
-		states: map[string]State{},
-		apiUrl: common.GetEnv("TITLE_GENERATOR_URL", ""),
-	}
+const defaultPath = "/api/dialogs/phrases-generator"
+
+func init() {
+	registry.Register("phrases-generator", defaultPath, func(path string, options registry.Options) (registry.Dialog, error) {
+		generator := NewDialog()
+		generator.path = path
+		return generator, nil
+	})
+}
+
+func NewDialog() *PhrasesGenerator {
+	return &PhrasesGenerator{path: defaultPath}
+}
+
+func (v *PhrasesGenerator) Init(deps *common.Dependencies) error {
+	v.skillID = deps.Config.Dialogs.PhrasesGenerator.SkillID
+	v.states = deps.SessionStore("phrases_generator")
+	v.apiUrl = deps.Config.Dialogs.PhrasesGenerator.URL
+	v.httpClient = deps.UpstreamClient("title_generator", 0)
+	v.answers = later.NewAnswers(10 * time.Minute)
+	return nil
 }
 
-func (v PhrasesGenerator) GetPath() string {
-	return "/api/dialogs/phrases-generator"
+func (v *PhrasesGenerator) Close(ctx context.Context) error {
+	return nil
 }
 
-func (v PhrasesGenerator) Health() (result bool, message string) {
-	if _, err := v.getAnswer("Тест"); err != nil {
-		return false, fmt.Sprintf("Exception occurred when getting message from API: %v", err)
+func (v *PhrasesGenerator) GetPath() string {
+	return v.path
+}
+
+func (v *PhrasesGenerator) GetSkillID() string {
+	return v.skillID
+}
+
+// Health reports state of title generator API by the last answer of it, without asking it.
+func (v *PhrasesGenerator) Health() (result bool, message string) {
+	if v.apiUrl == "" {
+		return false, "Title generator API URL is not configured"
 	}
-	return true, "OK"
+	return health.Upstream("title_generator")
 }
 
-func (v PhrasesGenerator) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+func (v *PhrasesGenerator) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	h := v.HandleRequestContext()
 	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		return h(context.Background(), request, response)
+	}
+}
+
+func (v *PhrasesGenerator) HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
 
 		if request.Session.New == true {
 			currentState := State{
-				action: "ask",
-				word:   "",
-				last:   "",
+				Action: "ask",
+				Word:   "",
+				Last:   "",
 			}
-			//v.mux.Lock()
-			//defer v.mux.Unlock()
-			v.states[request.Session.UserID] = currentState
+			v.saveState(ctx, request.Session.UserID, currentState)
 			response.Text("Здравствуйте! Просто произнесите слово, и я придумаю заголовок!")
 			return response
 		}
 
 		if strings.Contains(request.Text(), "помощь") || strings.Contains(request.Text(), "ты умеешь") {
 			currentState := State{
-				action: "ask",
-				word:   "",
-				last:   "",
+				Action: "ask",
+				Word:   "",
+				Last:   "",
 			}
-			//v.mux.Lock()
-			//defer v.mux.Unlock()
-			v.states[request.Session.UserID] = currentState
+			v.saveState(ctx, request.Session.UserID, currentState)
 			response.Text("Я могу придумывать заголовки для названного слова. Для того, чтобы начать просто назовите" +
 				" слово. Если вы хотите прослушать заголовок ещё раз, просто скажите - повтори, если хотите услышать другой " +
 				"заголовок к вашему слову, то скажите - ещё, а если хотите указать новое слово, то скажите - новое слово. " +
@@ -83,52 +121,62 @@ func (v PhrasesGenerator) HandleRequest() func(request *alice.Request, response
 		}
 
 		if strings.Contains(request.Text(), "хватит") || strings.Contains(request.Text(), "всё") {
-			delete(v.states, request.Session.UserID)
+			if err := v.states.Delete(ctx, request.Session.UserID); err != nil {
+				logger.Errorf("Cannot delete state of user %s: %v", logging.ID(request.Session.UserID), err)
+			}
 			response.Text("Заходите ещё.")
 			response.Response.EndSession = true
 			return response
 		}
 
-		if currentState, ok := v.states[request.Session.UserID]; ok {
+		if answer, ok := v.answers.Take(request.Session.SessionID); ok {
+			currentState, _ := v.getState(ctx, request.Session.UserID)
+			v.saveState(ctx, request.Session.UserID, State{
+				Action: "ans",
+				Word:   currentState.Word,
+				Last:   answer,
+			})
+			response.Text(later.Reminder + answer)
+			return response
+		}
+
+		if currentState, ok := v.getState(ctx, request.Session.UserID); ok {
+			statistics.ReportState(ctx, currentState.Action)
 
 			if strings.Contains(request.Text(), "ещё") || strings.Contains(request.Text(), "еще") || strings.Contains(request.Text(), "друго") {
-				if currentState.action == "ans" {
-					answer, _ := v.getAnswer(currentState.word)
+				if currentState.Action == "ans" {
+					answer := v.getAnswerInTime(ctx, request.Session.SessionID, currentState.Word)
 					response.Text(answer)
 					currentState = State{
-						action: "ans",
-						word:   currentState.word,
-						last:   answer,
+						Action: "ans",
+						Word:   currentState.Word,
+						Last:   answer,
 					}
-					v.states[request.Session.UserID] = currentState
+					v.saveState(ctx, request.Session.UserID, currentState)
 					return response
 				} else {
 					currentState := State{
-						action: "ask",
-						word:   "",
-						last:   "",
+						Action: "ask",
+						Word:   "",
+						Last:   "",
 					}
-					//v.mux.Lock()
-					//defer v.mux.Unlock()
-					v.states[request.Session.UserID] = currentState
+					v.saveState(ctx, request.Session.UserID, currentState)
 					response.Text("Произнесите слово, и я придумаю заголовок.")
 					return response
 				}
 			}
 
 			if strings.Contains(request.Text(), "повтори") || strings.Contains(request.Text(), "не понял") {
-				if currentState.action == "ans" {
-					response.Text(currentState.last)
+				if currentState.Action == "ans" {
+					response.Text(currentState.Last)
 					return response
 				} else {
 					currentState := State{
-						action: "ask",
-						word:   "",
-						last:   "",
+						Action: "ask",
+						Word:   "",
+						Last:   "",
 					}
-					//v.mux.Lock()
-					//defer v.mux.Unlock()
-					v.states[request.Session.UserID] = currentState
+					v.saveState(ctx, request.Session.UserID, currentState)
 					response.Text("Произнесите слово, и я придумаю заголовок.")
 					return response
 				}
@@ -136,46 +184,42 @@ func (v PhrasesGenerator) HandleRequest() func(request *alice.Request, response
 
 			if strings.Contains(request.Text(), "новое") || strings.Contains(request.Text(), "новый") {
 				currentState := State{
-					action: "ask",
-					word:   "",
-					last:   "",
+					Action: "ask",
+					Word:   "",
+					Last:   "",
 				}
-				//v.mux.Lock()
-				//defer v.mux.Unlock()
-				v.states[request.Session.UserID] = currentState
+				v.saveState(ctx, request.Session.UserID, currentState)
 				response.Text("Произнесите слово, и я придумаю заголовок.")
 				return response
 			}
 
-			if currentState.action == "ask" {
-				answer, _ := v.getAnswer(request.Text())
+			if currentState.Action == "ask" {
+				answer := v.getAnswerInTime(ctx, request.Session.SessionID, request.Text())
 				response.Text(answer)
 				currentState = State{
-					action: "ans",
-					word:   request.Text(),
-					last:   answer,
+					Action: "ans",
+					Word:   request.Text(),
+					Last:   answer,
 				}
-				v.states[request.Session.UserID] = currentState
+				v.saveState(ctx, request.Session.UserID, currentState)
 				return response
 			} else {
 				currentState = State{
-					action: "ask",
-					word:   "",
-					last:   "",
+					Action: "ask",
+					Word:   "",
+					Last:   "",
 				}
-				v.states[request.Session.UserID] = currentState
+				v.saveState(ctx, request.Session.UserID, currentState)
 				response.Text("Произнесите новое слово")
 				return response
 			}
 		} else {
 			currentState := State{
-				action: "ask",
-				word:   "",
-				last:   "",
+				Action: "ask",
+				Word:   "",
+				Last:   "",
 			}
-			//v.mux.Lock()
-			//defer v.mux.Unlock()
-			v.states[request.Session.UserID] = currentState
+			v.saveState(ctx, request.Session.UserID, currentState)
 			response.Text("Здравствуйте! Просто произнесите слово, и я придумаю заголовок.")
 			return response
 		}
@@ -183,8 +227,35 @@ func (v PhrasesGenerator) HandleRequest() func(request *alice.Request, response
 	}
 }
 
-func (v PhrasesGenerator) getAnswer(text string) (string, error) {
-	resp, err := http.PostForm(
+func (v *PhrasesGenerator) getState(ctx context.Context, userId string) (State, bool) {
+	state := State{}
+	ok, err := v.states.Get(ctx, userId, &state)
+	if err != nil {
+		logger.Errorf("Cannot load state of user %s: %v", logging.ID(userId), err)
+		return state, false
+	}
+	return state, ok
+}
+
+func (v *PhrasesGenerator) saveState(ctx context.Context, userId string, state State) {
+	if err := v.states.Set(ctx, userId, state); err != nil {
+		logger.Errorf("Cannot save state of user %s: %v", logging.ID(userId), err)
+	}
+}
+
+// getAnswerInTime returns title for word, or thinkingText if title is not generated before ctx is done.
+func (v *PhrasesGenerator) getAnswerInTime(ctx context.Context, sessionID string, word string) string {
+	answer, inTime, _ := v.answers.Get(ctx, sessionID, func(ctx context.Context) (string, error) {
+		return v.getAnswer(ctx, word)
+	})
+	if !inTime {
+		return thinkingText
+	}
+	return answer
+}
+
+func (v *PhrasesGenerator) getAnswer(ctx context.Context, text string) (string, error) {
+	resp, err := common.PostForm(ctx, v.httpClient,
 		v.apiUrl,
 		url.Values{
 			"moduleName": {"TitleGen"},
@@ -194,13 +265,13 @@ func (v PhrasesGenerator) getAnswer(text string) (string, error) {
 		},
 	)
 	if err != nil {
-		log.Print(err)
+		logging.FromContext(ctx, "phrases_generator").Errorf("Cannot get answer of title generator: %v", err)
 		return "Что-то пошло не так, попробуйте ещё раз", err
 	}
 	defer resp.Body.Close()
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Print(err)
+		logging.FromContext(ctx, "phrases_generator").Errorf("Cannot get answer of title generator: %v", err)
 		return "Что-то пошло не так, попробуйте ещё раз", err
 	}
 	bodyString := string(bodyBytes)
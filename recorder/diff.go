@@ -0,0 +1,94 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diff compares JSON documents and returns differences as lines `path: expected X, got Y`.
+// Fields with paths from ignore, like `session` or `response.tts`, and their children are not compared.
+func Diff(expected []byte, actual []byte, ignore []string) ([]string, error) {
+	var e, a interface{}
+	if err := json.Unmarshal(expected, &e); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(actual, &a); err != nil {
+		return nil, err
+	}
+	ignored := map[string]bool{}
+	for _, path := range ignore {
+		ignored[path] = true
+	}
+	var diffs []string
+	diff("", e, a, ignored, &diffs)
+	return diffs, nil
+}
+
+func diff(path string, expected interface{}, actual interface{}, ignored map[string]bool, diffs *[]string) {
+	if ignored[path] {
+		return
+	}
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := map[string]bool{}
+		for key := range e {
+			keys[key] = true
+		}
+		for key := range a {
+			keys[key] = true
+		}
+		var sorted []string
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			diff(join(path, key), e[key], a[key], ignored, diffs)
+		}
+		return
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(e) || i < len(a); i++ {
+			var ei, ai interface{}
+			if i < len(e) {
+				ei = e[i]
+			}
+			if i < len(a) {
+				ai = a[i]
+			}
+			diff(join(path, fmt.Sprint(i)), ei, ai, ignored, diffs)
+		}
+		return
+	}
+	if !equal(expected, actual) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got %s", path, format(expected), format(actual)))
+	}
+}
+
+func equal(a interface{}, b interface{}) bool {
+	return format(a) == format(b)
+}
+
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func format(value interface{}) string {
+	if value == nil {
+		return "nothing"
+	}
+	b, _ := json.Marshal(value)
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,208 @@
+package recorder
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"yandex-dialogs/logging"
+)
+
+var logger = logging.For("recorder")
+
+// Entry is a recorded request to dialog with the response to it.
+type Entry struct {
+	Time     time.Time       `json:"time"`
+	Path     string          `json:"path"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// anonymizedKeys hold identifiers, which are replaced with pseudonyms. The same value gets the same pseudonym, so
+// conversations can be replayed. Identifiers are replaced in all strings of request and response, as dialogs can repeat
+// them, like voice mail telling user id as a token.
+var anonymizedKeys = map[string]bool{"user_id": true, "session_id": true, "application_id": true}
+
+// removedKeys are removed from recorded requests.
+var removedKeys = map[string]bool{"access_token": true}
+
+// textKeys hold phrases of users and texts of responses, which can contain personal data, like names and phone numbers.
+// Their strings are replaced with hashes, unless recorder keeps texts.
+var textKeys = map[string]bool{"original_utterance": true, "command": true, "tokens": true, "text": true, "tts": true}
+
+// Recorder writes requests and responses of dialogs as JSON lines. It is safe for concurrent use.
+// Nil recorder records nothing.
+type Recorder struct {
+	mux      sync.Mutex
+	file     *os.File
+	writer   *bufio.Writer
+	salt     []byte
+	keepText bool
+}
+
+// NewRecorder creates recorder appending entries to file. Identifiers are replaced with pseudonyms salted with salt,
+// empty salt means random one, so pseudonyms differ between runs. Texts of users and responses are replaced with salted
+// hashes too, unless keepText is set, which is needed to replay recorded requests.
+func NewRecorder(path string, salt string, keepText bool) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	saltBytes := []byte(salt)
+	if salt == "" {
+		saltBytes = make([]byte, 32)
+		rand.Read(saltBytes)
+	}
+	return &Recorder{file: file, writer: bufio.NewWriter(file), salt: saltBytes, keepText: keepText}, nil
+}
+
+// Record writes anonymized request body and response to dialog with path.
+// Response is anonymized with identifiers of request, as it repeats session of request.
+func (r *Recorder) Record(path string, request []byte, response []byte) {
+	if r == nil {
+		return
+	}
+	var requestValue, responseValue interface{}
+	if err := json.Unmarshal(request, &requestValue); err != nil {
+		logger.Errorf("Cannot record request to %s: %v", path, err)
+		return
+	}
+	if err := json.Unmarshal(response, &responseValue); err != nil {
+		logger.Errorf("Cannot record response of %s: %v", path, err)
+		return
+	}
+	ids := map[string]bool{}
+	collectIDs(requestValue, ids)
+	collectIDs(responseValue, ids)
+	replacer := r.idReplacer(ids)
+	anonymizedRequest, err := json.Marshal(r.anonymizeValue(requestValue, false, replacer))
+	if err != nil {
+		logger.Errorf("Cannot record request to %s: %v", path, err)
+		return
+	}
+	anonymizedResponse, err := json.Marshal(r.anonymizeValue(responseValue, false, replacer))
+	if err != nil {
+		logger.Errorf("Cannot record response of %s: %v", path, err)
+		return
+	}
+	line, err := json.Marshal(Entry{Time: time.Now(), Path: path, Request: anonymizedRequest, Response: anonymizedResponse})
+	if err != nil {
+		logger.Errorf("Cannot record request to %s: %v", path, err)
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.writer.Write(line)
+	r.writer.WriteByte('\n')
+	// entries are flushed at once, so recording is not lost on crash
+	if err := r.writer.Flush(); err != nil {
+		logger.Errorf("Cannot record request to %s: %v", path, err)
+	}
+}
+
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.writer.Flush()
+	return r.file.Close()
+}
+
+// collectIDs adds non-empty identifiers of anonymizedKeys found in value to ids.
+func collectIDs(value interface{}, ids map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok && anonymizedKeys[key] && s != "" {
+				ids[s] = true
+			} else {
+				collectIDs(item, ids)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectIDs(item, ids)
+		}
+	}
+}
+
+// idReplacer returns replacer of identifiers with their pseudonyms. Longer identifiers are replaced first,
+// so identifier containing another one is replaced as a whole.
+func (r *Recorder) idReplacer(ids map[string]bool) *strings.Replacer {
+	var sorted []string
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	var pairs []string
+	for _, id := range sorted {
+		pairs = append(pairs, id, r.pseudonym(id))
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// anonymizeValue removes removedKeys from value and replaces identifiers in all strings of value with pseudonyms.
+// Strings of texts are replaced with hashes, unless recorder keeps texts. Empty strings are kept.
+func (r *Recorder) anonymizeValue(value interface{}, text bool, ids *strings.Replacer) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if removedKeys[key] {
+				delete(v, key)
+			} else {
+				v[key] = r.anonymizeValue(item, textKeys[key] && !r.keepText, ids)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.anonymizeValue(item, text, ids)
+		}
+	case string:
+		if text && v != "" {
+			return r.pseudonym(v)
+		}
+		return ids.Replace(v)
+	}
+	return value
+}
+
+func (r *Recorder) pseudonym(value string) string {
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// ReadEntries reads all entries of JSONL file.
+func ReadEntries(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
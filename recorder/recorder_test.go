@@ -0,0 +1,64 @@
+package recorder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	request  = `{"meta":{"locale":"ru-RU"},"request":{"command":"мой токен","original_utterance":"Мой токен","nlu":{"tokens":["мой","токен"]}},"session":{"session_id":"session-1","user_id":"USER-SECRET-ID","application_id":"app-1","message_id":1},"access_token":"oauth","version":"1.0"}`
+	response = `{"response":{"text":"Ваш токен: \nUSER-SECRET-ID","tts":"Ваш токен","buttons":[{"title":"Перейти, чтобы скопировать","url":"https://yandex.ru/search/?text=USER-SECRET-ID"}],"end_session":false},"session":{"session_id":"session-1","user_id":"USER-SECRET-ID","message_id":1},"version":"1.0"}`
+)
+
+func record(t *testing.T, keepText bool) string {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "recordings.jsonl")
+	rec, err := NewRecorder(file, "salt", keepText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Record("/api/dialogs/voice-mail", []byte(request), []byte(response))
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadEntries(file)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one entry, got %d, error %v", len(entries), err)
+	}
+	return string(entries[0].Request) + string(entries[0].Response)
+}
+
+func TestIdentifiersAreReplacedEverywhere(t *testing.T) {
+	recorded := record(t, true)
+	for _, secret := range []string{"USER-SECRET-ID", "session-1", "app-1", "oauth", "access_token"} {
+		if strings.Contains(recorded, secret) {
+			t.Errorf("expected %q not to be recorded, got %s", secret, recorded)
+		}
+	}
+	pseudonym := (&Recorder{salt: []byte("salt")}).pseudonym("USER-SECRET-ID")
+	if strings.Count(recorded, pseudonym) != 4 {
+		t.Errorf("expected pseudonym of user id in session and texts of response, got %s", recorded)
+	}
+	if !strings.Contains(recorded, `"command":"мой токен"`) || !strings.Contains(recorded, "text="+pseudonym) {
+		t.Errorf("expected kept texts with pseudonyms, got %s", recorded)
+	}
+}
+
+func TestTextsAreHashed(t *testing.T) {
+	recorded := record(t, false)
+	for _, text := range []string{"мой", "токен", "Ваш", "USER-SECRET-ID"} {
+		if strings.Contains(strings.ToLower(recorded), strings.ToLower(text)) {
+			t.Errorf("expected %q not to be recorded, got %s", text, recorded)
+		}
+	}
+	if !strings.Contains(recorded, `"locale":"ru-RU"`) || !strings.Contains(recorded, `"title":"Перейти, чтобы скопировать"`) {
+		t.Errorf("expected other fields to be recorded as is, got %s", recorded)
+	}
+}
@@ -0,0 +1,152 @@
+// Package registry keeps factories of dialogs by name. Packages of dialogs register their factories in init,
+// and server mounts dialogs listed in config, or all registered dialogs, if the list is empty.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/azzzak/alice"
+	"github.com/gorilla/mux"
+	"sort"
+	"strconv"
+	"sync"
+	"yandex-dialogs/common"
+	"yandex-dialogs/nlu"
+)
+
+// 1. Implement your handler (dialog) complying this interface. Put implementation in separated folder/package.
+type Dialog interface {
+	// Returns func which takes incoming Alice request and prepared response with filled `session` information. Response should be returned.
+	HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response
+
+	// Returns base path of your dialog REST API. For example, `/api/dialogs/sample-dialog`
+	GetPath() string
+
+	// Returns expected `session.skill_id` of incoming requests. Empty string disables skill id check.
+	GetSkillID() string
+
+	// Returns state of dialog (true - ok, false - something is wrong) and additional string message.
+	Health() (result bool, message string)
+
+	// Additional custom HTTP request handlers
+	ApiHandlers(router *mux.Router)
+
+	// Reads settings, gets connections from shared dependencies and starts background jobs, like cron schedulers.
+	// Called once before server starts accepting requests. Dialog returning error is disabled, other dialogs keep working.
+	Init(deps *common.Dependencies) error
+
+	// Stops background jobs and waits for running ones until ctx is done. Shared connections are closed after all dialogs.
+	// Called on shutdown after server stopped accepting requests and in-flight requests are handled.
+	Close(ctx context.Context) error
+}
+
+// Optionally implement this interface to handle intents, configured in skill console.
+type IntentDialog interface {
+	// Returns handlers by intent name. Handler is called instead of `HandleRequest` when request contains the intent.
+	IntentHandlers() map[string]nlu.Handler
+}
+
+// Optionally implement this interface to answer with own apology when handling of request fails with panic.
+// By default user is asked to try again later.
+type ApologyDialog interface {
+	// Fills response with apology. Response contains session information only.
+	Apology(request *alice.Request, response *alice.Response) *alice.Response
+}
+
+// Optionally implement this interface to stop handling request when Alice no longer waits for response.
+type ContextDialog interface {
+	// Like `HandleRequest`, but ctx is done when time to respond is over. Pass it to upstream and DB calls.
+	HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response
+}
+
+// Optionally implement this interface to split long answers into pages instead of cutting them to 1024 characters.
+// User gets the next page on "дальше" or "ещё" without calling the dialog, see reply.Pager.
+type PagedDialog interface {
+	// Returns max length of page in characters. Zero means the limit of Alice.
+	PageSize() int
+}
+
+// Options are settings of mounted dialog, which differ between mounts of the same dialog, like timeouts.
+type Options map[string]string
+
+func (o Options) String(key, fallback string) string {
+	if value, ok := o[key]; ok {
+		return value
+	}
+	return fallback
+}
+
+// Int returns option as int, fallback if option is not set. Error is returned if option is not a number.
+func (o Options) Int(key string, fallback int64) (int64, error) {
+	value, ok := o[key]
+	if !ok {
+		return fallback, nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fallback, fmt.Errorf("option %s has invalid value %q: %v", key, value, err)
+	}
+	return i, nil
+}
+
+// 2. Register factory of your dialog in init of its package and import the package in main.
+// Factory creates dialog serving requests on path. Dialog is not inited yet, options should be checked by factory.
+type Factory func(path string, options Options) (Dialog, error)
+
+type registration struct {
+	path    string
+	factory Factory
+}
+
+var (
+	lock          sync.RWMutex
+	registrations = map[string]registration{}
+)
+
+// Register makes dialog available by name, the name of its config section. Path is default path of dialog.
+// Panics if name is already registered, as it is a programming error.
+func Register(name, path string, factory Factory) {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := registrations[name]; ok {
+		panic("dialog " + name + " is already registered")
+	}
+	registrations[name] = registration{path: path, factory: factory}
+}
+
+// Names returns sorted names of registered dialogs.
+func Names() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	names := make([]string, 0, len(registrations))
+	for name := range registrations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultPath returns path of dialog, which is used if mount has no path. Returns false if dialog is not registered.
+func DefaultPath(name string) (string, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	r, ok := registrations[name]
+	return r.path, ok
+}
+
+// New creates dialog by name, mounted on path with options. Empty path means default path of dialog.
+func New(name, path string, options Options) (Dialog, error) {
+	lock.RLock()
+	r, ok := registrations[name]
+	lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("dialog %s is not registered", name)
+	}
+	if path == "" {
+		path = r.path
+	}
+	if options == nil {
+		options = Options{}
+	}
+	return r.factory(path, options)
+}
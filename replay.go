@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/azzzak/alice"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"yandex-dialogs/auth"
+	"yandex-dialogs/common"
+	"yandex-dialogs/config"
+	"yandex-dialogs/recorder"
+	"yandex-dialogs/registry"
+	"yandex-dialogs/statistics"
+)
+
+// replay feeds requests recorded with RECORD_FILE and RECORD_TEXT through dialog and prints differences between recorded and actual responses.
+// Returns exit code: 0 if all responses match, 1 if some differ, 2 if replay failed.
+// Dialog uses the same settings as server, so point DB connections to test databases before replaying.
+func replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	name := flags.String("dialog", "", "Name of dialog to replay requests to, or the last element of its path, for example `masha`")
+	file := flags.String("file", "recordings.jsonl", "JSONL file with recorded requests")
+	ignore := flags.String("ignore", "", "Comma separated paths of response fields not compared, for example `response.tts,session_state`")
+	flags.Parse(args)
+
+	cfg := loadConfig()
+	dialog, err := offlineDialog(cfg, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	entries, err := recorder.ReadEntries(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read %s: %v\n", *file, err)
+		return 2
+	}
+
+	h, closeDialog, err := offlineHandler(dialog, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot init dialog %s: %v\n", *name, err)
+		return 2
+	}
+	defer closeDialog()
+
+	var ignored []string
+	if *ignore != "" {
+		ignored = strings.Split(*ignore, ",")
+	}
+	total, failed := 0, 0
+	for i, entry := range entries {
+		if entry.Path != dialog.GetPath() {
+			continue
+		}
+		total++
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("POST", entry.Path, bytes.NewReader(entry.Request)))
+		if w.Code != http.StatusOK {
+			failed++
+			fmt.Printf("line %d: status %d\n", i+1, w.Code)
+			continue
+		}
+		diffs, err := recorder.Diff(entry.Response, w.Body.Bytes(), ignored)
+		if err != nil {
+			failed++
+			fmt.Printf("line %d: %v\n", i+1, err)
+			continue
+		}
+		if len(diffs) > 0 {
+			failed++
+			fmt.Printf("line %d:\n\t%s\n", i+1, strings.Join(diffs, "\n\t"))
+		}
+	}
+	fmt.Printf("%d of %d responses of %s differ\n", failed, total, dialog.GetPath())
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// offlineDialog creates dialog by name, mounted like on server, if config mounts it by name or on path with the last element name.
+// Otherwise dialog is created on default path. Dialogs disabled in config can be created too.
+func offlineDialog(cfg *config.Config, name string) (Dialog, error) {
+	for _, mount := range cfg.Mounts {
+		if mount.Dialog == name || (mount.Path != "" && path.Base(mount.Path) == name) {
+			return registry.New(mount.Dialog, mount.Path, mount.Options)
+		}
+	}
+	return registry.New(name, "", nil)
+}
+
+// offlineHandler inits dialog and returns handler of its requests, processing them like server does, but without authentication,
+// statistics and recording. Returned func stops dialog and closes its connections.
+func offlineHandler(dialog Dialog, cfg *config.Config) (func(w http.ResponseWriter, r *http.Request), func(), error) {
+	deps := common.NewDependencies(cfg)
+	if err := dialog.Init(deps); err != nil {
+		deps.Close()
+		return nil, nil, err
+	}
+	// recorded and simulated requests can not pass authentication
+	h := handleRequest(dialog, newPager(dialog, deps), auth.AuthenticatorFunc(func(*http.Request, []byte, *alice.Request) error {
+		return nil
+	}), statistics.NewAggregator(nil), nil)
+	return h, func() {
+		dialog.Close(context.Background())
+		deps.Close()
+	}, nil
+}
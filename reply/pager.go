@@ -0,0 +1,149 @@
+package reply
+
+import (
+	"context"
+	"github.com/azzzak/alice"
+	"strings"
+	"unicode/utf8"
+	"yandex-dialogs/common"
+	"yandex-dialogs/intents"
+	"yandex-dialogs/logging"
+)
+
+var logger = logging.For("reply")
+
+const (
+	nextPrompt = "\n\nСкажите «дальше», чтобы продолжить."
+	nextButton = "Дальше"
+)
+
+var continuation = intents.NewMatcher(intents.Intent{
+	Name:    "next",
+	Phrases: []string{"дальше", "ещё", "еще", "продолжай", "продолжи", "давай дальше", "что дальше", "следующая"},
+	Exact:   true,
+})
+
+// Pager splits long texts of responses into pages. The first page is sent in response, the rest is kept in session store
+// and sent page by page, when user says "дальше" or "ещё". Any other phrase drops the rest, and request goes to dialog.
+//
+// Nil pager does not paginate, but still cuts responses to Alice limits.
+type Pager struct {
+	store common.SessionStore
+	size  int
+}
+
+// pages are the rest of paginated text of session, with buttons of the original response.
+type pages struct {
+	SessionID string
+	Pages     []string
+	Buttons   []alice.Button
+}
+
+// NewPager returns pager, which keeps pages in store by user id. Size is the max length of page in characters,
+// from a third of MaxTextLength to MaxTextLength, which is used if size is out of the range.
+func NewPager(store common.SessionStore, size int) *Pager {
+	if size < MaxTextLength/3 || size > MaxTextLength {
+		size = MaxTextLength
+	}
+	return &Pager{store: store, size: size}
+}
+
+// Continue fills response with the next page, if user asks to continue and there is rest of text in the session.
+// Returns nil otherwise.
+func (p *Pager) Continue(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	if p == nil {
+		return nil
+	}
+	key := request.Session.UserID
+	rest := &pages{}
+	found, err := p.store.Get(ctx, key, rest)
+	if err != nil {
+		logger.Warnf("Cannot load pages: %v", err)
+		return nil
+	}
+	if !found {
+		return nil
+	}
+	if rest.SessionID != request.Session.SessionID || len(rest.Pages) == 0 || continuation.Match(request.Text()).Name == "" {
+		if err := p.store.Delete(ctx, key); err != nil {
+			logger.Warnf("Cannot delete pages: %v", err)
+		}
+		return nil
+	}
+	response.Response.Text = rest.Pages[0]
+	response.Response.Buttons = rest.Buttons
+	rest.Pages = rest.Pages[1:]
+	p.save(ctx, key, rest, response)
+	return response
+}
+
+// Paginate leaves the first page of long text in response and keeps the rest for Continue. Speech of paginated response
+// follows text of page. Response ending session, with card or with speech differing from text is not paginated, as card
+// and speech can not be split with text, but cut to limits, like responses of nil pager.
+func (p *Pager) Paginate(ctx context.Context, request *alice.Request, response *alice.Response) {
+	if response == nil {
+		return
+	}
+	if p == nil || response.Response.EndSession || response.Response.Card != nil || hasSpeech(response) ||
+		utf8.RuneCountInString(response.Response.Text) <= p.size {
+		Limit(response)
+		return
+	}
+	all := split(response.Response.Text, p.size-utf8.RuneCountInString(nextPrompt))
+	response.Response.Text = all[0]
+	response.Response.TTS = ""
+	p.save(ctx, request.Session.UserID, &pages{
+		SessionID: request.Session.SessionID,
+		Pages:     all[1:],
+		Buttons:   response.Response.Buttons,
+	}, response)
+	Limit(response)
+}
+
+// hasSpeech reports whether response has speech differing from text, like pauses, sounds or stress marks.
+// Speech of text cut by Build follows text.
+func hasSpeech(response *alice.Response) bool {
+	tts := response.Response.TTS
+	return tts != "" && tts != response.Response.Text && tts != strings.TrimSuffix(response.Response.Text, ellipsis)
+}
+
+// save keeps the rest of pages, if any, and asks user to continue in response.
+func (p *Pager) save(ctx context.Context, key string, rest *pages, response *alice.Response) {
+	if len(rest.Pages) == 0 {
+		if err := p.store.Delete(ctx, key); err != nil {
+			logger.Warnf("Cannot delete pages: %v", err)
+		}
+		return
+	}
+	if err := p.store.Set(ctx, key, rest); err != nil {
+		logger.Warnf("Cannot save pages: %v", err)
+		return
+	}
+	response.Response.Text += nextPrompt
+	response.Response.Buttons = append([]alice.Button{{Title: nextButton, Hide: true}}, response.Response.Buttons...)
+}
+
+// Limit cuts text, speech and titles of buttons of response to Alice limits.
+func Limit(response *alice.Response) {
+	for i := range response.Response.Buttons {
+		response.Response.Buttons[i].Title = truncate(response.Response.Buttons[i].Title, MaxButtonTitleLength)
+	}
+	if utf8.RuneCountInString(response.Response.Text) > MaxTextLength || utf8.RuneCountInString(response.Response.TTS) > MaxTTSLength {
+		New(response).Build()
+	}
+}
+
+// ForSpeaker drops buttons with links and card of response, which speaker without screen can not show.
+func ForSpeaker(response *alice.Response) {
+	if response == nil {
+		return
+	}
+	buttons := response.Response.Buttons[:0]
+	for _, button := range response.Response.Buttons {
+		if button.URL == "" {
+			buttons = append(buttons, button)
+		}
+	}
+	response.Response.Buttons = buttons
+	response.Response.Card = nil
+}
@@ -0,0 +1,122 @@
+package reply
+
+import (
+	"context"
+	"fmt"
+	"github.com/azzzak/alice"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"yandex-dialogs/common"
+)
+
+func request(session, text string) *alice.Request {
+	req := &alice.Request{}
+	req.Session.UserID = "user"
+	req.Session.SessionID = session
+	req.Request.Command = text
+	req.Request.OriginalUtterance = text
+	return req
+}
+
+func longText() string {
+	lines := make([]string, 40)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("Страна %d - %d человек", i, 1000*i)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestPagesAreSentOnContinuation(t *testing.T) {
+	pager := NewPager(common.NewMemoryStore(time.Minute), 400)
+	response := &alice.Response{}
+	response.Text(longText()).Button("Выйти", "", true)
+	pager.Paginate(context.Background(), request("session", "очаги"), response)
+
+	var text []string
+	for i := 0; ; i++ {
+		if utf8.RuneCountInString(response.Response.Text) > 400 {
+			t.Errorf("page %d is longer than page size: %d", i, utf8.RuneCountInString(response.Response.Text))
+		}
+		buttons := response.Response.Buttons
+		if buttons[len(buttons)-1].Title != "Выйти" {
+			t.Errorf("expected buttons of dialog on page %d, got %+v", i, buttons)
+		}
+		if !strings.HasSuffix(response.Response.Text, nextPrompt) {
+			text = append(text, response.Response.Text)
+			break
+		}
+		if buttons[0].Title != nextButton {
+			t.Errorf("expected next button on page %d, got %+v", i, buttons)
+		}
+		text = append(text, strings.TrimSuffix(response.Response.Text, nextPrompt))
+		if response = pager.Continue(context.Background(), request("session", "дальше"), &alice.Response{}); response == nil {
+			t.Fatalf("expected page %d", i+1)
+		}
+	}
+	if len(text) < 3 || strings.Join(text, "\n") != longText() {
+		t.Errorf("expected text split on lines into pages, got %q", text)
+	}
+	if pager.Continue(context.Background(), request("session", "дальше"), &alice.Response{}) != nil {
+		t.Error("expected no pages after the last one")
+	}
+}
+
+func TestPagesAreDroppedOnOtherPhrase(t *testing.T) {
+	pager := NewPager(common.NewMemoryStore(time.Minute), 400)
+	pager.Paginate(context.Background(), request("session", "очаги"), (&alice.Response{}).Text(longText()))
+	if pager.Continue(context.Background(), request("session", "симптомы"), &alice.Response{}) != nil {
+		t.Error("expected request to go to dialog")
+	}
+	if pager.Continue(context.Background(), request("session", "ещё"), &alice.Response{}) != nil {
+		t.Error("expected pages to be dropped")
+	}
+
+	pager.Paginate(context.Background(), request("session", "очаги"), (&alice.Response{}).Text(longText()))
+	if pager.Continue(context.Background(), request("new session", "ещё"), &alice.Response{}) != nil {
+		t.Error("expected pages of previous session to be dropped")
+	}
+}
+
+func TestNilPagerLimitsResponse(t *testing.T) {
+	var pager *Pager
+	if pager.Continue(context.Background(), request("session", "дальше"), &alice.Response{}) != nil {
+		t.Error("expected nil pager to ignore continuation")
+	}
+	response := (&alice.Response{}).Text(strings.Repeat(longText()+"\n", 3))
+	pager.Paginate(context.Background(), request("session", "очаги"), response)
+	if utf8.RuneCountInString(response.Response.Text) > MaxTextLength {
+		t.Errorf("expected text cut to limit, got %d characters", utf8.RuneCountInString(response.Response.Text))
+	}
+}
+
+func TestResponsesWithSpeechOrCardAreNotPaginated(t *testing.T) {
+	pager := NewPager(common.NewMemoryStore(time.Minute), 400)
+	responses := map[string]*alice.Response{
+		"speech": New(&alice.Response{}).Text(longText()).Pause(500).Build(),
+		"card":   New(&alice.Response{}).Text(longText()).ItemsList("Страны", []Item{{Title: "Страна 1"}}, "").Build(),
+	}
+	for name, response := range responses {
+		tts, card := response.Response.TTS, response.Response.Card
+		pager.Paginate(context.Background(), request("session", "очаги"), response)
+		if strings.HasSuffix(response.Response.Text, nextPrompt) || response.Response.TTS != tts || response.Response.Card != card {
+			t.Errorf("expected response with %s to be kept, got %+v", name, response.Response)
+		}
+		if utf8.RuneCountInString(response.Response.Text) > MaxTextLength {
+			t.Errorf("expected response with %s to be cut to limit, got %d characters", name, utf8.RuneCountInString(response.Response.Text))
+		}
+		if pager.Continue(context.Background(), request("session", "дальше"), &alice.Response{}) != nil {
+			t.Errorf("expected no pages of response with %s", name)
+		}
+	}
+
+	// speech of text cut to limit follows text
+	for _, text := range []string{strings.Repeat(longText()+"\n", 3), strings.Repeat("слово ", 300)} {
+		response := New(&alice.Response{}).Text(text).Build()
+		pager.Paginate(context.Background(), request("session", "очаги"), response)
+		if !strings.HasSuffix(response.Response.Text, nextPrompt) || response.Response.TTS != "" {
+			t.Errorf("expected text cut by builder to be paginated, got %+v", response.Response)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package reply builds responses of dialogs: text with speech, buttons, cards and sounds, keeping them within Alice limits.
+//
+// Speech follows text, unless it is set explicitly with TextWithTTS or extended with pauses and sounds, then response
+// gets separate TTS. Texts over limits are cut on word boundary, the rest of text is available with Overflow.
+package reply
+
+import (
+	"fmt"
+	"github.com/azzzak/alice"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits of Alice response, in characters.
+const (
+	MaxTextLength            = 1024
+	MaxTTSLength             = 1024
+	MaxButtonTitleLength     = 64
+	MaxCardTitleLength       = 128
+	MaxCardDescriptionLength = 256
+	MaxCardHeaderLength      = 64
+	MaxCardFooterLength      = 64
+	MaxListItems             = 5
+)
+
+const ellipsis = "…"
+
+// Item is an item of ItemsList card. Image is optional.
+type Item struct {
+	ImageID     string
+	Title       string
+	Description string
+	// Button makes item clickable, like button with title, url and payload. Optional.
+	Button *alice.ImageButton
+}
+
+// Builder fills response of dialog. Use Build to get response after all parts are added.
+type Builder struct {
+	response    *alice.Response
+	text        strings.Builder
+	tts         strings.Builder
+	separateTTS bool
+	overflow    string
+}
+
+// New returns builder of response, which keeps text, speech, buttons and card already set in response.
+func New(response *alice.Response) *Builder {
+	b := &Builder{response: response}
+	b.text.WriteString(response.Response.Text)
+	if response.Response.TTS != "" {
+		b.tts.WriteString(response.Response.TTS)
+		b.separateTTS = true
+	} else {
+		b.tts.WriteString(response.Response.Text)
+	}
+	return b
+}
+
+// Text adds text, which is spoken as is.
+func (b *Builder) Text(text string) *Builder {
+	b.text.WriteString(text)
+	b.tts.WriteString(text)
+	return b
+}
+
+// Textf adds formatted text, which is spoken as is.
+func (b *Builder) Textf(format string, args ...interface{}) *Builder {
+	return b.Text(fmt.Sprintf(format, args...))
+}
+
+// TextWithTTS adds text, which is spoken as tts. Tts can contain stress marks, see Accent, and other TTS markup.
+func (b *Builder) TextWithTTS(text, tts string) *Builder {
+	b.text.WriteString(text)
+	return b.Speech(tts)
+}
+
+// Speech adds tts, which is not shown as text.
+func (b *Builder) Speech(tts string) *Builder {
+	b.tts.WriteString(tts)
+	b.separateTTS = true
+	return b
+}
+
+// Pause adds pause of given milliseconds to speech.
+func (b *Builder) Pause(ms int) *Builder {
+	if ms <= 0 {
+		return b
+	}
+	return b.Speech(fmt.Sprintf(" sil <[%d]> ", ms))
+}
+
+// Sound adds sound of Alice sound library to speech, for example `alice-sounds-things-bell-1`.
+// Names of sounds are defined in github.com/azzzak/alice/sounds package.
+func (b *Builder) Sound(name string) *Builder {
+	return b.Speech(fmt.Sprintf(`<speaker audio="%s.opus">`, strings.TrimSuffix(name, ".opus")))
+}
+
+// CustomSound adds sound uploaded to skill in Yandex Dialogs to speech.
+func (b *Builder) CustomSound(skillID, soundID string) *Builder {
+	return b.Speech(fmt.Sprintf(`<speaker audio="dialogs-upload/%s/%s.opus">`, skillID, strings.TrimSuffix(soundID, ".opus")))
+}
+
+// Button adds button, which sends its title as user phrase. Hidden buttons disappear after user answers.
+func (b *Builder) Button(title string, hide bool) *Builder {
+	b.response.Button(truncate(title, MaxButtonTitleLength), "", hide)
+	return b
+}
+
+// Buttons adds hidden buttons by titles.
+func (b *Builder) Buttons(titles ...string) *Builder {
+	for _, title := range titles {
+		b.Button(title, true)
+	}
+	return b
+}
+
+// Link adds button opening url.
+func (b *Builder) Link(title, url string) *Builder {
+	b.response.Button(truncate(title, MaxButtonTitleLength), url, false)
+	return b
+}
+
+// BigImage shows one big image with title and description. Image should be uploaded to skill in Yandex Dialogs.
+func (b *Builder) BigImage(imageID, title, description string) *Builder {
+	b.response.BigImage(imageID, truncate(title, MaxCardTitleLength), truncate(description, MaxCardDescriptionLength))
+	return b
+}
+
+// ItemsList shows list of items with header and footer, which may be empty. Only the first MaxListItems items are shown,
+// the number of others is added to footer if footer is empty.
+func (b *Builder) ItemsList(header string, items []Item, footer string) *Builder {
+	if len(items) > MaxListItems {
+		if footer == "" {
+			footer = fmt.Sprintf("И ещё %d", len(items)-MaxListItems)
+		}
+		items = items[:MaxListItems]
+	}
+	list := alice.List{}
+	for _, item := range items {
+		image := alice.Image{
+			ImageID:     item.ImageID,
+			Title:       truncate(item.Title, MaxCardTitleLength),
+			Description: truncate(item.Description, MaxCardDescriptionLength),
+			Button:      item.Button,
+		}
+		list.AddImages(image)
+	}
+	b.response.List(truncate(header, MaxCardHeaderLength), truncate(footer, MaxCardFooterLength), list)
+	if header == "" {
+		b.response.Response.Card.Header = nil
+	}
+	if footer == "" {
+		b.response.Response.Card.Footer = nil
+	}
+	return b
+}
+
+// EndSession ends session after response.
+func (b *Builder) EndSession() *Builder {
+	b.response.Response.EndSession = true
+	return b
+}
+
+// Build sets text and speech of response, cutting them to limits, and returns response.
+func (b *Builder) Build() *alice.Response {
+	text, rest := cut(b.text.String(), MaxTextLength)
+	b.overflow = rest
+	b.response.Response.Text = text
+	b.response.Response.TTS = ""
+	if b.separateTTS {
+		b.response.Response.TTS, _ = cut(b.tts.String(), MaxTTSLength)
+	} else if rest != "" {
+		// speech is cut with text, but without ellipsis
+		b.response.Response.TTS = strings.TrimSuffix(text, ellipsis)
+	}
+	return b.response
+}
+
+// Overflow returns text, which did not fit into response on Build.
+func (b *Builder) Overflow() string {
+	return b.overflow
+}
+
+// Accent returns word with stress mark before vowel by number, starting from 1, for example Accent("замок", 2) is "зам+ок".
+// Word is returned as is if it has less vowels.
+func Accent(word string, vowel int) string {
+	n := 0
+	for i, r := range word {
+		if strings.ContainsRune("аеёиоуыэюяАЕЁИОУЫЭЮЯaeiouyAEIOUY", r) {
+			n++
+			if n == vowel {
+				return word[:i] + "+" + word[i:]
+			}
+		}
+	}
+	return word
+}
+
+// truncate cuts text to limit of characters, replacing the end with ellipsis.
+func truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimRightFunc(string(runes[:limit-1]), unicode.IsSpace) + ellipsis
+}
+
+// cut splits text to head, which fits into limit of characters, and the rest. Text is cut on line break in the last half
+// of head, otherwise on whitespace outside of TTS markup, like `<speaker audio="...">`, and then head ends with ellipsis.
+// Text without whitespace is cut on limit.
+func cut(text string, limit int) (string, string) {
+	if utf8.RuneCountInString(text) <= limit {
+		return text, ""
+	}
+	runes := []rune(text)
+	max := limit - utf8.RuneCountInString(ellipsis)
+	space, line, depth := -1, -1, 0
+	for i := 0; i <= max && i < len(runes); i++ {
+		switch runes[i] {
+		case '<':
+			depth++
+		case '>':
+			if depth > 0 {
+				depth--
+			}
+		case '\n':
+			if depth == 0 && i >= limit/2 {
+				line = i
+			}
+			fallthrough
+		default:
+			if depth == 0 && unicode.IsSpace(runes[i]) {
+				space = i
+			}
+		}
+	}
+	end, suffix := space, ellipsis
+	if line > 0 {
+		end, suffix = line, ""
+	} else if space <= 0 {
+		end = max
+	}
+	head := strings.TrimRightFunc(string(runes[:end]), unicode.IsSpace)
+	rest := strings.TrimLeftFunc(string(runes[end:]), unicode.IsSpace)
+	return head + suffix, rest
+}
+
+// split splits text to pages, which fit into size of characters.
+func split(text string, size int) []string {
+	var pages []string
+	for text != "" {
+		var page string
+		page, text = cut(text, size)
+		pages = append(pages, page)
+	}
+	return pages
+}
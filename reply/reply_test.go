@@ -0,0 +1,89 @@
+package reply
+
+import (
+	"fmt"
+	"github.com/azzzak/alice"
+	"github.com/azzzak/alice/sounds"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTextIsSpoken(t *testing.T) {
+	response := New(&alice.Response{}).Text("Привет! ").Textf("Сегодня %d градусов.", 20).Build()
+	if response.Response.Text != "Привет! Сегодня 20 градусов." || response.Response.TTS != "" {
+		t.Errorf("expected text without separate tts, got %+v", response.Response)
+	}
+}
+
+func TestPausesAndSounds(t *testing.T) {
+	response := New(&alice.Response{}).
+		Sound(sounds.ThingsBell1).
+		Text("Сообщение.").
+		Pause(500).
+		TextWithTTS("Замок", Accent("замок", 2)).
+		Build()
+	if response.Response.Text != "Сообщение.Замок" {
+		t.Errorf("unexpected text %q", response.Response.Text)
+	}
+	if response.Response.TTS != `<speaker audio="alice-sounds-things-bell-1.opus">Сообщение. sil <[500]> зам+ок` {
+		t.Errorf("unexpected tts %q", response.Response.TTS)
+	}
+}
+
+func TestLongTextIsCut(t *testing.T) {
+	words := make([]string, 300)
+	for i := range words {
+		words[i] = fmt.Sprintf("слово%d", i)
+	}
+	text := strings.Join(words, " ")
+	b := New(&alice.Response{}).Text(text)
+	response := b.Build()
+	if utf8.RuneCountInString(response.Response.Text) > MaxTextLength || !strings.HasSuffix(response.Response.Text, "…") {
+		t.Errorf("expected text cut to limit with ellipsis, got %d characters", utf8.RuneCountInString(response.Response.Text))
+	}
+	if strings.TrimSuffix(response.Response.Text, "…")+" "+b.Overflow() != text {
+		t.Errorf("expected the rest of text in overflow, got %q", b.Overflow())
+	}
+	if response.Response.TTS != strings.TrimSuffix(response.Response.Text, "…") {
+		t.Errorf("expected tts cut with text, got %q", response.Response.TTS)
+	}
+}
+
+func TestMarkupIsNotCut(t *testing.T) {
+	sound := `<speaker audio="alice-sounds-things-bell-1.opus">`
+	text, rest := cut(strings.Repeat("а", 20)+" "+sound+" б", 40)
+	if text != strings.Repeat("а", 20)+"…" || rest != sound+" б" {
+		t.Errorf("expected cut before markup, got %q and %q", text, rest)
+	}
+}
+
+func TestButtonsAndCards(t *testing.T) {
+	items := make([]Item, 7)
+	for i := range items {
+		items[i] = Item{Title: fmt.Sprintf("Страна %d", i), Description: strings.Repeat("д", 300)}
+	}
+	response := New(&alice.Response{}).
+		Text("Список").
+		Button(strings.Repeat("к", 100), true).
+		ItemsList("Заголовок", items, "").
+		Build()
+	if title := response.Response.Buttons[0].Title; utf8.RuneCountInString(title) != MaxButtonTitleLength {
+		t.Errorf("expected button title cut to limit, got %q", title)
+	}
+	card := response.Response.Card
+	if card == nil || card.Type != alice.ItemsListType || len(card.Items) != MaxListItems {
+		t.Fatalf("expected list of %d items, got %+v", MaxListItems, card)
+	}
+	if card.Header.Text != "Заголовок" || card.Footer.Text != "И ещё 2" {
+		t.Errorf("unexpected header and footer %+v %+v", card.Header, card.Footer)
+	}
+	if utf8.RuneCountInString(card.Items[0].Description) != MaxCardDescriptionLength {
+		t.Errorf("expected description cut to limit, got %d characters", utf8.RuneCountInString(card.Items[0].Description))
+	}
+
+	response = New(&alice.Response{}).BigImage("1540737/f9d0b2ce4ad38cd0baae", "Картинка", "").Build()
+	if response.Response.Card.Type != alice.BigImageType || response.Response.Card.ImageID != "1540737/f9d0b2ce4ad38cd0baae" {
+		t.Errorf("unexpected big image %+v", response.Response.Card)
+	}
+}
@@ -0,0 +1,123 @@
+// Package simulator builds requests of Alice for local runs of dialogs, without Alice and Yandex servers.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/azzzak/alice"
+	"strings"
+	"unicode"
+)
+
+// User simulates user talking to skill. The first phrase of user starts new session.
+type User struct {
+	ID string
+	// Speaker makes requests come from smart speaker without screen, instead of phone
+	Speaker bool
+
+	sessionID string
+	sessions  int
+	messageID int
+	// state of skill kept by Alice, see Remember
+	sessionState map[string]json.RawMessage
+	userState    map[string]json.RawMessage
+}
+
+func NewUser(id string) *User {
+	return &User{ID: id}
+}
+
+// NewSession makes the next phrase start new session, as if user closed and opened skill again.
+func (u *User) NewSession() {
+	u.sessionID = ""
+	u.sessionState = nil
+}
+
+// Request builds request with the next phrase of user in current session.
+func (u *User) Request(text string) *alice.Request {
+	newSession := u.sessionID == ""
+	if newSession {
+		u.sessions++
+		u.sessionID = fmt.Sprintf("%s-session-%d", u.ID, u.sessions)
+		u.messageID = 0
+	} else {
+		u.messageID++
+	}
+	request := NewRequest(u.ID, u.sessionID, u.messageID, newSession, text)
+	if u.Speaker {
+		request.Meta.Interfaces.Screen = nil
+	}
+	return request
+}
+
+// Marshal returns body of request of user with state of skill saved from the last response, like Alice sends it.
+func (u *User) Marshal(request *alice.Request) ([]byte, error) {
+	type state struct {
+		Session map[string]json.RawMessage `json:"session,omitempty"`
+		User    map[string]json.RawMessage `json:"user,omitempty"`
+	}
+	return json.Marshal(struct {
+		*alice.Request
+		State state `json:"state"`
+	}{request, state{Session: u.sessionState, User: u.userState}})
+}
+
+// Remember saves state of skill from body of response to send it back with the next requests, like Alice does:
+// session state is replaced until the end of session, and user state is updated, with null value removing key.
+func (u *User) Remember(body []byte) error {
+	response := struct {
+		SessionState    map[string]json.RawMessage `json:"session_state"`
+		UserStateUpdate map[string]json.RawMessage `json:"user_state_update"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	u.sessionState = response.SessionState
+	for key, value := range response.UserStateUpdate {
+		if string(value) == "null" {
+			delete(u.userState, key)
+			continue
+		}
+		if u.userState == nil {
+			u.userState = map[string]json.RawMessage{}
+		}
+		u.userState[key] = value
+	}
+	return nil
+}
+
+// NewRequest builds request like Alice does: command is the phrase in lower case without punctuation, split to tokens.
+// Request comes from device with screen.
+func NewRequest(userID string, sessionID string, messageID int, newSession bool, text string) *alice.Request {
+	tokens := Tokens(text)
+	request := &alice.Request{Version: "1.0"}
+	request.Meta.Locale = "ru-RU"
+	request.Meta.Timezone = "Europe/Moscow"
+	request.Meta.ClientID = "simulator"
+	request.Meta.Interfaces.Screen = &struct{}{}
+	request.Request.Command = strings.Join(tokens, " ")
+	request.Request.OriginalUtterance = text
+	request.Request.Type = "SimpleUtterance"
+	request.Request.NLU.Tokens = tokens
+	request.Session.New = newSession
+	request.Session.MessageID = messageID
+	request.Session.SessionID = sessionID
+	request.Session.UserID = userID
+	return request
+}
+
+// Tokens splits phrase to words in lower case, dropping punctuation.
+func Tokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// NewResponse returns empty response to request with filled session, like server does.
+func NewResponse(request *alice.Request) *alice.Response {
+	response := &alice.Response{Version: "1.0"}
+	response.Session.MessageID = request.Session.MessageID
+	response.Session.SessionID = request.Session.SessionID
+	response.Session.UserID = request.Session.UserID
+	return response
+}
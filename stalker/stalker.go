@@ -1,34 +1,51 @@
 package stalker
 
 import (
-	"errors"
+	"context"
 	"github.com/azzzak/alice"
 	"github.com/go-bongo/bongo"
 	"github.com/gorilla/mux"
 	"gopkg.in/mgo.v2/bson"
-	"log"
 	"math/rand"
 	"net/http"
-	"strings"
 	"time"
 	"yandex-dialogs/common"
+	"yandex-dialogs/intents"
+	"yandex-dialogs/logging"
+	"yandex-dialogs/metrics"
+	"yandex-dialogs/registry"
+	"yandex-dialogs/statistics"
 )
 
-var mongoConnection = common.GetEnv("COMMON_MONGO_CONNECTION", "")
-var databaseName = common.GetEnv("COMMON_DATABASE_NAME", "common")
+var logger = logging.For("stalker")
 
-var helpWords = []string{"помощь", "что ты може", "что ты умеешь"}
-var laughWords = []string{"ха ха", "аха", "хах"}
+var helpWords = []string{"помощь", "что ты може*", "что ты умеешь"}
+var laughWords = []string{"ха ха", "аха*", "хах*", "ахах*"}
 var notFunnyWords = []string{"не смешно"}
 
+const (
+	helpCommand     = "help"
+	laughCommand    = "laugh"
+	notFunnyCommand = "not_funny"
+)
+
+var commands = intents.NewMatcher(
+	intents.Intent{Name: helpCommand, Phrases: helpWords, Priority: 30},
+	intents.Intent{Name: laughCommand, Phrases: laughWords, Priority: 20},
+	intents.Intent{Name: notFunnyCommand, Phrases: notFunnyWords, Priority: 10},
+)
+
 type Stalker struct {
-	httpClient http.Client
+	path       string
+	skillID    string
+	httpClient *http.Client
 	connection *bongo.Connection
+	mongo      *common.Connections
 	jokes      []Joke
-	context    map[string]string
+	context    common.SessionStore
 }
 
-func (c Stalker) ApiHandlers(router *mux.Router) {
+func (c *Stalker) ApiHandlers(router *mux.Router) {
 	// no implementation here
 }
 
@@ -48,70 +65,64 @@ type User struct {
 	Jokes              []string `json:"jokes"`
 }
 
-func NewStalker() Stalker {
+const defaultPath = "/api/dialogs/stalker"
+
+func init() {
+	registry.Register("stalker", defaultPath, func(path string, options registry.Options) (registry.Dialog, error) {
+		stalker := NewStalker()
+		stalker.path = path
+		return stalker, nil
+	})
+}
+
+func NewStalker() *Stalker {
+	return &Stalker{path: defaultPath}
+}
+
+func (c *Stalker) Init(deps *common.Dependencies) error {
 	rand.Seed(time.Now().Unix())
-	config := &bongo.Config{
-		ConnectionString: mongoConnection,
-		Database:         databaseName,
-	}
-	connection, err := bongo.Connect(config)
+	connection, err := deps.Mongo.Get(deps.Config.Common.MongoConnection, deps.Config.Common.DatabaseName)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	connection.Session.SetPoolLimit(50)
-	stalker := Stalker{
-		httpClient: http.Client{Timeout: time.Millisecond * 20000},
-		connection: connection,
-		context:    map[string]string{},
-	}
-	stalker.initJokes()
-	return stalker
+	c.skillID = deps.Config.Dialogs.Stalker.SkillID
+	c.httpClient = deps.HttpClient
+	c.connection = connection
+	c.mongo = deps.Mongo
+	c.context = deps.SessionStore("stalker")
+	c.initJokes()
+	return nil
+}
+
+func (c *Stalker) Close(ctx context.Context) error {
+	return nil
+}
+
+func (c *Stalker) GetPath() string {
+	return c.path
 }
 
-func (c Stalker) GetPath() string {
-	return "/api/dialogs/stalker"
+func (c *Stalker) GetSkillID() string {
+	return c.skillID
 }
 
-func (c Stalker) Health() (result bool, message string) {
-	if c.Ping() != nil {
-		log.Printf("Ping failed")
-		c.Reconnect()
+func (c *Stalker) Health() (result bool, message string) {
+	if err := c.mongo.Ping(c.connection); err != nil {
+		logger.Warnf("Ping of DB failed: %v", err)
 		return false, "DB is not available"
 	}
 	return true, "OK"
 }
 
-func (c Stalker) Reconnect() {
-	err := c.connection.Connect()
-	if err != nil {
-		log.Print(err)
+func (c *Stalker) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	h := c.HandleRequestContext()
+	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		return h(context.Background(), request, response)
 	}
-	c.connection.Session.SetPoolLimit(50)
 }
 
-func (c Stalker) Ping() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Print("Recovered in f", r)
-			err = errors.New("Error ping")
-		}
-	}()
-	err = c.connection.Session.Ping()
-	return err
-}
-
-func (c Stalker) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
-	return func(request *alice.Request, response *alice.Response) (resp *alice.Response) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Print("Recovered in f: ", r)
-				response.Text("Произошла ошибка, попробуйте в другой раз")
-				response.Button("Закончить", "", true)
-				resp = response
-			}
-		}()
-		c.Health()
-
+func (c *Stalker) HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
 		isNew := false
 		user := c.getUser(request.UserID())
 		if user == nil {
@@ -121,17 +132,20 @@ func (c Stalker) HandleRequest() func(request *alice.Request, response *alice.Re
 			isNew = true
 		}
 
-		if containsIgnoreCase(request.Text(), helpWords) {
+		command := commands.Match(request.Text())
+		statistics.ReportCommand(ctx, command.Name)
+
+		if command.Name == helpCommand {
 			response.Text("Рассказываю анекдоты из любимой многими игры. Просто попроси про что рассказать анекдот, и расскажу." +
 				"Для того, чтобы оценить андектод - нужно просто посмеяться в ответ, если анекдот не понравился - я думаю, вы знаете что делать.")
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), laughWords) {
+		if command.Name == laughCommand {
 			response.Text("Уважаю. Слушаем дальше?")
-			joke := c.getJokeById(c.context[user.Id])
+			joke := c.getJokeById(c.getContext(ctx, user.Id))
 			if joke != nil {
-				if !containsIgnoreCase(user.Id, joke.Likes) {
+				if !contains(joke.Likes, user.Id) {
 					joke.Likes = append(joke.Likes, user.Id)
 					c.saveJoke(joke)
 				}
@@ -141,11 +155,11 @@ func (c Stalker) HandleRequest() func(request *alice.Request, response *alice.Re
 			return response
 		}
 
-		if containsIgnoreCase(request.Text(), notFunnyWords) {
+		if command.Name == notFunnyCommand {
 			response.Text("Ну вот. Слушаем дальше?")
-			joke := c.getJokeById(c.context[user.Id])
+			joke := c.getJokeById(c.getContext(ctx, user.Id))
 			if joke != nil {
-				if !containsIgnoreCase(user.Id, joke.Dislikes) {
+				if !contains(joke.Dislikes, user.Id) {
 					joke.Likes = append(joke.Likes, user.Id)
 					c.saveJoke(joke)
 				}
@@ -158,8 +172,10 @@ func (c Stalker) HandleRequest() func(request *alice.Request, response *alice.Re
 		if len(request.Text()) > 0 {
 			num := rand.Intn(len(c.jokes))
 			joke := c.jokes[num]
-			c.context[user.Id] = joke.Id
-			if !containsIgnoreCase(joke.Id, user.Jokes) {
+			if err := c.context.Set(ctx, user.Id, joke.Id); err != nil {
+				logger.Errorf("Cannot save context of user %s: %v", logging.ID(user.Id), err)
+			}
+			if !contains(user.Jokes, joke.Id) {
 				user.Jokes = append(user.Jokes, joke.Id)
 				c.saveUser(user)
 			}
@@ -185,6 +201,7 @@ func (c Stalker) HandleRequest() func(request *alice.Request, response *alice.Re
 }
 
 func (c *Stalker) initJokes() {
+	defer metrics.ObserveMongo("jokes", "find", time.Now())
 	resultSet := c.connection.Collection("jokes").Find(bson.M{})
 	var jokes []Joke
 	joke := &Joke{}
@@ -196,8 +213,9 @@ func (c *Stalker) initJokes() {
 	}
 }
 
-func (c Stalker) getUser(id string) *User {
+func (c *Stalker) getUser(id string) *User {
 	user := &User{}
+	defer metrics.ObserveMongo("stalkers", "find", time.Now())
 	err := c.connection.Collection("stalkers").FindOne(bson.M{"id": id}, user)
 	if err != nil {
 		return nil
@@ -205,21 +223,31 @@ func (c Stalker) getUser(id string) *User {
 	return user
 }
 
-func (c Stalker) saveUser(user *User) {
+func (c *Stalker) saveUser(user *User) {
+	defer metrics.ObserveMongo("stalkers", "save", time.Now())
 	err := c.connection.Collection("stalkers").Save(user)
 	if err != nil {
-		log.Print("Error when saving to DB")
+		logger.Errorf("Error when saving to DB: %v", err)
 	}
 }
 
-func (c Stalker) saveJoke(joke *Joke) {
+func (c *Stalker) saveJoke(joke *Joke) {
+	defer metrics.ObserveMongo("jokes", "save", time.Now())
 	err := c.connection.Collection("jokes").Save(joke)
 	if err != nil {
-		log.Print("Error when saving to DB")
+		logger.Errorf("Error when saving to DB: %v", err)
+	}
+}
+
+func (c *Stalker) getContext(ctx context.Context, userId string) string {
+	jokeId := ""
+	if _, err := c.context.Get(ctx, userId, &jokeId); err != nil {
+		logger.Errorf("Cannot load context of user %s: %v", logging.ID(userId), err)
 	}
+	return jokeId
 }
 
-func (c Stalker) getJokeById(id string) *Joke {
+func (c *Stalker) getJokeById(id string) *Joke {
 	for _, joke := range c.jokes {
 		if joke.Id == id {
 			return &joke
@@ -228,9 +256,9 @@ func (c Stalker) getJokeById(id string) *Joke {
 	return nil
 }
 
-func containsIgnoreCase(message string, wordsToCheck []string) bool {
-	for _, word := range wordsToCheck {
-		if strings.Contains(strings.ToUpper(message), strings.ToUpper(word)) {
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
 			return true
 		}
 	}
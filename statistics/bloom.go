@@ -0,0 +1,61 @@
+package statistics
+
+import (
+	"encoding/binary"
+)
+
+const bloomBits = 1 << 22
+const bloomHashes = 7
+
+// BloomFilter remembers seen values using fixed 512 KB of memory.
+// It has no false negatives, and false positive rate is about 1% for 400 thousands of values.
+// It is not safe for concurrent use.
+type BloomFilter struct {
+	bits []byte
+}
+
+func NewBloomFilter() *BloomFilter {
+	return &BloomFilter{bits: make([]byte, bloomBits/8)}
+}
+
+// Add adds value and reports whether it was added before, probably.
+func (b *BloomFilter) Add(value string) bool {
+	x := hash(value)
+	h1, h2 := x&0xffffffff, x>>32
+	seen := true
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % bloomBits
+		if b.bits[bit/8]&(1<<(bit%8)) == 0 {
+			seen = false
+			b.bits[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	return seen
+}
+
+// Merge adds values of other filter to this one.
+func (b *BloomFilter) Merge(other *BloomFilter) {
+	for i, v := range other.bits {
+		b.bits[i] |= v
+	}
+}
+
+// words returns non-zero 64-bit words of filter by index. Filter of few users is sparse, so it is saved by words.
+func (b *BloomFilter) words() map[int]uint64 {
+	words := map[int]uint64{}
+	for i := 0; i < len(b.bits); i += 8 {
+		if word := binary.LittleEndian.Uint64(b.bits[i:]); word != 0 {
+			words[i/8] = word
+		}
+	}
+	return words
+}
+
+// mergeWord adds bits of 64-bit word by index, as returned by words. Returns false if index is out of filter.
+func (b *BloomFilter) mergeWord(index int, word uint64) bool {
+	if index < 0 || index >= len(b.bits)/8 {
+		return false
+	}
+	binary.LittleEndian.PutUint64(b.bits[index*8:], binary.LittleEndian.Uint64(b.bits[index*8:])|word)
+	return true
+}
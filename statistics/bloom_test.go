@@ -0,0 +1,51 @@
+package statistics
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	b := NewBloomFilter()
+	const n = 100000
+	for i := 0; i < n; i++ {
+		b.Add("user-" + strconv.Itoa(i))
+	}
+	for i := 0; i < n; i++ {
+		if !b.Add("user-" + strconv.Itoa(i)) {
+			t.Fatalf("expected user-%d to be seen", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if b.Add("other-" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.01 {
+		t.Errorf("expected false positive rate under 1%%, got %.2f%%", rate*100)
+	}
+}
+
+func TestBloomFilterWords(t *testing.T) {
+	b := NewBloomFilter()
+	b.Add("alice")
+	b.Add("bob")
+	words := b.words()
+	if len(words) == 0 || len(words) > 2*bloomHashes {
+		t.Errorf("expected up to %d words of 2 users, got %d", 2*bloomHashes, len(words))
+	}
+
+	restored := NewBloomFilter()
+	for i, word := range words {
+		if !restored.mergeWord(i, word) {
+			t.Fatalf("expected word %d to be merged", i)
+		}
+	}
+	if !restored.Add("alice") || !restored.Add("bob") {
+		t.Error("expected users of merged words to be seen")
+	}
+	if restored.mergeWord(bloomBits/64, 1) || restored.mergeWord(-1, 1) {
+		t.Error("expected words out of filter to be rejected")
+	}
+}
@@ -0,0 +1,74 @@
+package statistics
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const hllPrecision = 12
+const hllRegisters = 1 << hllPrecision
+
+// HyperLogLog estimates number of unique values using fixed 4 KB of memory. Standard error is about 1.6%.
+// It is not safe for concurrent use.
+type HyperLogLog struct {
+	registers []uint8
+}
+
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]uint8, hllRegisters)}
+}
+
+func (h *HyperLogLog) Add(value string) {
+	x := hash(value)
+	index := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Merge adds values of other sketch to this one.
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, rank := range other.registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+}
+
+// Count returns estimated number of unique added values.
+func (h *HyperLogLog) Count() int {
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	m := float64(hllRegisters)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small cardinalities are estimated better by number of empty registers
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(estimate + 0.5)
+}
+
+func (h *HyperLogLog) Clone() *HyperLogLog {
+	return &HyperLogLog{registers: append([]uint8{}, h.registers...)}
+}
+
+// hash mixes FNV hash of value, as its high bits are not distributed well enough for HyperLogLog.
+func hash(value string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(value))
+	x := f.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,47 @@
+package statistics
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLogAccuracy(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 100, 1000, 10000, 100000, 500000} {
+		h := NewHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add("user-" + strconv.Itoa(i))
+			// repeated values are not counted
+			h.Add("user-" + strconv.Itoa(i/2))
+		}
+		count := h.Count()
+		if n == 0 {
+			if count != 0 {
+				t.Errorf("expected 0 for empty sketch, got %d", count)
+			}
+			continue
+		}
+		// 3 standard errors
+		if e := math.Abs(float64(count-n)) / float64(n); e > 0.05 {
+			t.Errorf("expected about %d, got %d (error %.1f%%)", n, count, e*100)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, b, union := NewHyperLogLog(), NewHyperLogLog(), NewHyperLogLog()
+	for i := 0; i < 20000; i++ {
+		value := strconv.Itoa(i)
+		if i < 15000 {
+			a.Add(value)
+		}
+		if i >= 5000 {
+			b.Add(value)
+		}
+		union.Add(value)
+	}
+	a.Merge(b)
+	if a.Count() != union.Count() {
+		t.Errorf("expected merged sketch to count union %d, got %d", union.Count(), a.Count())
+	}
+}
@@ -0,0 +1,71 @@
+package statistics
+
+import (
+	"context"
+	"sync"
+)
+
+// labelCollector collects labels reported by dialog while handling request.
+// Dialog may report them from several goroutines.
+type labelCollector struct {
+	mux    sync.Mutex
+	labels []string
+}
+
+type labelsKey struct{}
+
+// Begin returns context of request, in which labels reported by dialog are collected. Labels are returned by End.
+func Begin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, labelsKey{}, &labelCollector{})
+}
+
+// End returns unique labels reported in context of request.
+func End(ctx context.Context) []string {
+	collector, ok := ctx.Value(labelsKey{}).(*labelCollector)
+	if !ok {
+		return nil
+	}
+	collector.mux.Lock()
+	defer collector.mux.Unlock()
+	var unique []string
+	seen := map[string]bool{}
+	for _, label := range collector.labels {
+		if !seen[label] {
+			seen[label] = true
+			unique = append(unique, label)
+		}
+	}
+	return unique
+}
+
+// Report adds labels to statistics of request, like recognized command or state of dialog.
+// Labels should be taken from a small fixed set, as each label is counted separately per day.
+// Labels reported out of request handling, in context not started by Begin, are ignored.
+func Report(ctx context.Context, labels ...string) {
+	collector, ok := ctx.Value(labelsKey{}).(*labelCollector)
+	if !ok {
+		return
+	}
+	collector.mux.Lock()
+	defer collector.mux.Unlock()
+	collector.labels = append(collector.labels, labels...)
+}
+
+// ReportCommand reports command recognized in user phrase. Empty name is ignored.
+func ReportCommand(ctx context.Context, name string) {
+	if name != "" {
+		Report(ctx, "command:"+name)
+	}
+}
+
+// ReportState reports state of dialog, in which request is handled.
+func ReportState(ctx context.Context, state string) {
+	if state != "" {
+		Report(ctx, "state:"+state)
+	}
+}
+
+// ReportIntent reports intent of Yandex NLU, which handled request.
+func ReportIntent(ctx context.Context, name string) {
+	Report(ctx, "intent:"+name)
+}
@@ -0,0 +1,27 @@
+package statistics
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	ReportCommand(context.Background(), "ignored")
+	if labels := End(context.Background()); labels != nil {
+		t.Errorf("expected no labels out of request, got %q", labels)
+	}
+
+	ctx := Begin(context.Background())
+	ReportState(ctx, "main")
+	ReportCommand(ctx, "")
+	ReportCommand(ctx, "help")
+	ReportState(ctx, "main")
+	ReportIntent(ctx, "YANDEX.HELP")
+	if labels := End(ctx); !reflect.DeepEqual(labels, []string{"state:main", "command:help", "intent:YANDEX.HELP"}) {
+		t.Errorf("unexpected labels %q", labels)
+	}
+	if labels := End(Begin(ctx)); labels != nil {
+		t.Errorf("expected labels of nested request to be collected separately, got %q", labels)
+	}
+}
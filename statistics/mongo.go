@@ -0,0 +1,189 @@
+package statistics
+
+import (
+	"errors"
+	"github.com/go-bongo/bongo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+	"time"
+	"yandex-dialogs/metrics"
+)
+
+// MongoStore keeps statistics in MongoDB collection, one document per dialog and day.
+// Seen users are kept in a separate collection, one document per dialog.
+//
+// Statistics are merged with atomic updates, so several instances can flush into the same documents: counters are
+// incremented, registers of users sketch are raised to maximum and words of seen users filter are OR-ed.
+// Only non-zero registers and words are sent.
+type MongoStore struct {
+	collection *bongo.Collection
+	seen       *bongo.Collection
+}
+
+type statisticsDocument struct {
+	Key      string `bson:"key"`
+	Day      string `bson:"day"`
+	Messages int    `bson:"messages"`
+	// UserRegisters are non-zero registers of HyperLogLog by index.
+	UserRegisters  map[string]int `bson:"userRegisters,omitempty"`
+	NewUsers       int            `bson:"newUsers"`
+	Sessions       int            `bson:"sessions"`
+	SessionSeconds float64        `bson:"sessionSeconds"`
+	// LabelCounts are counts by label, escaped by escapeKey.
+	LabelCounts map[string]int `bson:"labelCounts,omitempty"`
+}
+
+type seenDocument struct {
+	Key string `bson:"key"`
+	// Words are non-zero 64-bit words of filter by index.
+	Words map[string]int64 `bson:"words,omitempty"`
+}
+
+func NewMongoStore(connection *bongo.Connection, collection string) *MongoStore {
+	store := &MongoStore{collection: connection.Collection(collection), seen: connection.Collection(collection + "_users")}
+	err := store.collection.Collection().EnsureIndex(mgo.Index{Key: []string{"key", "day"}, Unique: true})
+	if err != nil {
+		logger.Errorf("Cannot create index for %s: %v", collection, err)
+	}
+	err = store.seen.Collection().EnsureIndex(mgo.Index{Key: []string{"key"}, Unique: true})
+	if err != nil {
+		logger.Errorf("Cannot create index for %s_users: %v", collection, err)
+	}
+	return store
+}
+
+func (s *MongoStore) Load() ([]Record, error) {
+	defer metrics.ObserveMongo("statistics", "find", time.Now())
+	var documents []statisticsDocument
+	if err := s.collection.Collection().Find(bson.M{}).All(&documents); err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, document := range documents {
+		record, err := document.record()
+		if err != nil {
+			logger.Warnf("Skipped statistics of %s for %s: %v", document.Key, document.Day, err)
+			continue
+		}
+		records = append(records, *record)
+	}
+	return records, nil
+}
+
+// Merge adds statistics of record to saved document of record atomically.
+func (s *MongoStore) Merge(record Record) error {
+	defer metrics.ObserveMongo("statistics", "merge", time.Now())
+	_, err := s.collection.Collection().Upsert(bson.M{"key": record.Key, "day": record.Day}, mergeUpdate(record))
+	return err
+}
+
+func (s *MongoStore) LoadSeen() (map[string]*BloomFilter, error) {
+	defer metrics.ObserveMongo("statistics_users", "find", time.Now())
+	var documents []seenDocument
+	if err := s.seen.Collection().Find(bson.M{}).All(&documents); err != nil {
+		return nil, err
+	}
+	seen := map[string]*BloomFilter{}
+	for _, document := range documents {
+		filter, err := document.filter()
+		if err != nil {
+			logger.Warnf("Skipped seen users of %s: %v", document.Key, err)
+			continue
+		}
+		seen[document.Key] = filter
+	}
+	return seen, nil
+}
+
+// MergeSeen adds users of filter to saved filter atomically. Filter should contain users seen since previous merge,
+// as all its non-zero words are sent.
+func (s *MongoStore) MergeSeen(key string, seen *BloomFilter) error {
+	update := seenUpdate(seen)
+	if update == nil {
+		return nil
+	}
+	defer metrics.ObserveMongo("statistics_users", "merge", time.Now())
+	_, err := s.seen.Collection().Upsert(bson.M{"key": key}, update)
+	return err
+}
+
+// mergeUpdate returns update of statistics document adding record to it.
+func mergeUpdate(record Record) bson.M {
+	inc := bson.M{
+		"messages":       record.Messages,
+		"newUsers":       record.NewUsers,
+		"sessions":       record.Sessions,
+		"sessionSeconds": record.SessionSeconds,
+	}
+	for label, count := range record.Labels {
+		inc["labelCounts."+escapeKey(label)] = count
+	}
+	update := bson.M{"$inc": inc}
+	registers := bson.M{}
+	for i, rank := range record.Users.registers {
+		if rank > 0 {
+			registers["userRegisters."+strconv.Itoa(i)] = int(rank)
+		}
+	}
+	if len(registers) > 0 {
+		update["$max"] = registers
+	}
+	return update
+}
+
+// seenUpdate returns update of seen document adding users of filter to it. Returns nil if filter is empty.
+func seenUpdate(seen *BloomFilter) bson.M {
+	words := bson.M{}
+	for i, word := range seen.words() {
+		words["words."+strconv.Itoa(i)] = bson.M{"or": int64(word)}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	return bson.M{"$bit": words}
+}
+
+func (d *statisticsDocument) record() (*Record, error) {
+	record := newRecord(d.Key, d.Day)
+	for index, rank := range d.UserRegisters {
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 || i >= hllRegisters || rank < 0 || rank > 64 {
+			return nil, errors.New("invalid register of HyperLogLog " + index)
+		}
+		record.Users.registers[i] = uint8(rank)
+	}
+	record.Messages = d.Messages
+	record.NewUsers = d.NewUsers
+	record.Sessions = d.Sessions
+	record.SessionSeconds = d.SessionSeconds
+	for label, count := range d.LabelCounts {
+		record.Labels[unescapeKey(label)] = count
+	}
+	return record, nil
+}
+
+func (d *seenDocument) filter() (*BloomFilter, error) {
+	filter := NewBloomFilter()
+	for index, word := range d.Words {
+		i, err := strconv.Atoi(index)
+		if err != nil || !filter.mergeWord(i, uint64(word)) {
+			return nil, errors.New("invalid word of bloom filter " + index)
+		}
+	}
+	return filter, nil
+}
+
+// keyEscaper escapes characters not allowed in keys of documents, like dots in labels with phrases.
+var keyEscaper = strings.NewReplacer("%", "%25", ".", "%2E", "$", "%24")
+
+var keyUnescaper = strings.NewReplacer("%2E", ".", "%24", "$", "%25", "%")
+
+func escapeKey(key string) string {
+	return keyEscaper.Replace(key)
+}
+
+func unescapeKey(key string) string {
+	return keyUnescaper.Replace(key)
+}
@@ -0,0 +1,99 @@
+package statistics
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"testing"
+)
+
+func TestMergeUpdate(t *testing.T) {
+	record := newRecord("/test", "2020-04-01")
+	record.Messages = 3
+	record.NewUsers = 1
+	record.Users.Add("alice")
+	record.Labels["command:next_page"] = 2
+	record.Labels["text:1.5$"] = 1
+
+	update := mergeUpdate(*record)
+	inc := update["$inc"].(bson.M)
+	if inc["messages"] != 3 || inc["newUsers"] != 1 || inc["labelCounts.command:next_page"] != 2 || inc["labelCounts.text:1%2E5%24"] != 1 {
+		t.Errorf("expected counters to be incremented, got %+v", inc)
+	}
+	if registers := update["$max"].(bson.M); len(registers) != 1 {
+		t.Errorf("expected only non-zero register of one user, got %+v", registers)
+	}
+	if _, ok := mergeUpdate(*newRecord("/test", "2020-04-01"))["$max"]; ok {
+		t.Error("expected no registers of record without users")
+	}
+}
+
+func TestSeenUpdate(t *testing.T) {
+	if seenUpdate(NewBloomFilter()) != nil {
+		t.Error("expected no update of empty filter")
+	}
+	seen := NewBloomFilter()
+	seen.Add("alice")
+	words := seenUpdate(seen)["$bit"].(bson.M)
+	if len(words) == 0 || len(words) > bloomHashes {
+		t.Errorf("expected words of one user, got %+v", words)
+	}
+}
+
+func TestStatisticsDocument(t *testing.T) {
+	merged := newRecord("/test", "2020-04-01")
+	merged.Users.Add("alice")
+	merged.Users.Add("bob")
+	merged.Labels["text:1.5"] = 1
+	registers := map[string]int{}
+	for key, value := range mergeUpdate(*merged)["$max"].(bson.M) {
+		registers[key[len("userRegisters."):]] = value.(int)
+	}
+	data, err := bson.Marshal(bson.M{
+		"key":           "/test",
+		"day":           "2020-04-01",
+		"messages":      5,
+		"userRegisters": registers,
+		"labelCounts":   map[string]int{"state:main": 3, "text:1%2E5": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := &statisticsDocument{}
+	if err := bson.Unmarshal(data, document); err != nil {
+		t.Fatal(err)
+	}
+	record, err := document.record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Messages != 5 || record.Users.Count() != 2 || record.Labels["state:main"] != 3 || record.Labels["text:1.5"] != 1 {
+		t.Errorf("expected merged statistics, got %+v", record)
+	}
+
+	document.UserRegisters = map[string]int{"4096": 1}
+	if _, err := document.record(); err == nil {
+		t.Error("expected error for register out of sketch")
+	}
+}
+
+func TestSeenDocument(t *testing.T) {
+	merged := NewBloomFilter()
+	merged.Add("alice")
+	merged.Add("bob")
+	document := &seenDocument{Key: "/test", Words: map[string]int64{}}
+	for i, word := range merged.words() {
+		document.Words[strconv.Itoa(i)] = int64(word)
+	}
+	filter, err := document.filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.Add("alice") || !filter.Add("bob") || filter.Add("carol") {
+		t.Error("expected only users of merged words to be seen")
+	}
+
+	document.Words["x"] = 1
+	if _, err := document.filter(); err == nil {
+		t.Error("expected error for invalid word")
+	}
+}
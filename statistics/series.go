@@ -0,0 +1,110 @@
+package statistics
+
+import (
+	"errors"
+	"time"
+)
+
+type Granularity string
+
+const (
+	Day   Granularity = "day"
+	Week  Granularity = "week"
+	Month Granularity = "month"
+)
+
+func ParseGranularity(value string) (Granularity, error) {
+	switch Granularity(value) {
+	case "":
+		return Day, nil
+	case Day, Week, Month:
+		return Granularity(value), nil
+	}
+	return "", errors.New("granularity should be one of day, week or month")
+}
+
+// ParseDay parses day in format YYYY-MM-DD.
+func ParseDay(value string) (time.Time, error) {
+	return time.ParseInLocation(dayLayout, value, Location)
+}
+
+// period returns name of period containing day: the day itself, Monday of the week or YYYY-MM of the month.
+func (g Granularity) period(day time.Time) string {
+	switch g {
+	case Week:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset).Format(dayLayout)
+	case Month:
+		return day.Format("2006-01")
+	}
+	return day.Format(dayLayout)
+}
+
+// Point is statistics of dialog for a period.
+// ActiveUsers is an estimated number of unique users. ReturningUsers are active users seen before the period.
+type Point struct {
+	Period             string         `json:"period"`
+	Messages           int            `json:"messages"`
+	ActiveUsers        int            `json:"activeUsers"`
+	NewUsers           int            `json:"newUsers"`
+	ReturningUsers     int            `json:"returningUsers"`
+	Sessions           int            `json:"sessions"`
+	MessagesPerSession float64        `json:"messagesPerSession"`
+	AvgSessionSeconds  float64        `json:"avgSessionSeconds"`
+	Labels             map[string]int `json:"labels"`
+}
+
+func newPoint(period string, record *Record) Point {
+	point := Point{
+		Period:      period,
+		Messages:    record.Messages,
+		ActiveUsers: record.Users.Count(),
+		NewUsers:    record.NewUsers,
+		Sessions:    record.Sessions,
+		Labels:      record.Labels,
+	}
+	// estimation error of active users can make them fewer than exactly counted new users
+	if point.ActiveUsers < point.NewUsers {
+		point.ActiveUsers = point.NewUsers
+	}
+	point.ReturningUsers = point.ActiveUsers - point.NewUsers
+	if record.Sessions > 0 {
+		point.MessagesPerSession = float64(record.Messages) / float64(record.Sessions)
+		point.AvgSessionSeconds = record.SessionSeconds / float64(record.Sessions)
+	}
+	return point
+}
+
+// Series returns statistics of dialogs with keys accepted by match for days from..to inclusive, split by periods.
+// Periods without messages are included with zero values. Total is statistics for the whole range.
+func (a *Aggregator) Series(match func(key string) bool, from, to time.Time, granularity Granularity) (points []Point, total Point) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	var periods []string
+	byPeriod := map[string]*Record{}
+	for day := from.In(Location); !day.After(to); day = day.AddDate(0, 0, 1) {
+		period := granularity.period(day)
+		if _, ok := byPeriod[period]; !ok {
+			byPeriod[period] = newRecord("", period)
+			periods = append(periods, period)
+		}
+	}
+	all := newRecord("", "")
+	first, last := from.In(Location).Format(dayLayout), to.In(Location).Format(dayLayout)
+	for k, record := range a.totals {
+		if k.day < first || k.day > last || !match(k.key) {
+			continue
+		}
+		day, err := ParseDay(k.day)
+		if err != nil {
+			continue
+		}
+		byPeriod[granularity.period(day)].Merge(*record)
+		all.Merge(*record)
+	}
+	for _, period := range periods {
+		points = append(points, newPoint(period, byPeriod[period]))
+	}
+	return points, newPoint(first+".."+last, all)
+}
@@ -0,0 +1,333 @@
+package statistics
+
+import (
+	"context"
+	"sync"
+	"time"
+	"yandex-dialogs/logging"
+)
+
+var logger = logging.For("statistics")
+
+// Location is a time zone of days statistics is split by. Most of users of dialogs live in Moscow time zone.
+var Location = time.FixedZone("MSK", 3*60*60)
+
+// SessionTimeout is a time of inactivity, after which session is not tracked anymore.
+var SessionTimeout = 30 * time.Minute
+
+const dayLayout = "2006-01-02"
+
+// Record is statistics of dialog for a day.
+type Record struct {
+	Key            string
+	Day            string
+	Messages       int
+	Users          *HyperLogLog
+	NewUsers       int
+	Sessions       int
+	SessionSeconds float64
+	Labels         map[string]int
+}
+
+func newRecord(key string, day string) *Record {
+	return &Record{Key: key, Day: day, Users: NewHyperLogLog(), Labels: map[string]int{}}
+}
+
+// Merge adds statistics of other record to this one.
+func (r *Record) Merge(other Record) {
+	r.Messages += other.Messages
+	r.Users.Merge(other.Users)
+	r.NewUsers += other.NewUsers
+	r.Sessions += other.Sessions
+	r.SessionSeconds += other.SessionSeconds
+	for label, count := range other.Labels {
+		r.Labels[label] += count
+	}
+}
+
+// Store persists statistics.
+type Store interface {
+	// Load returns all saved records.
+	Load() ([]Record, error)
+
+	// Merge adds statistics of record to saved one.
+	Merge(record Record) error
+
+	// LoadSeen returns saved filters of seen users by key.
+	LoadSeen() (map[string]*BloomFilter, error)
+
+	// MergeSeen adds users of filter to saved filter of seen users.
+	MergeSeen(key string, seen *BloomFilter) error
+}
+
+// Event is a message of user to dialog.
+type Event struct {
+	UserID     string
+	SessionID  string
+	NewSession bool
+	Labels     []string
+	At         time.Time
+}
+
+type recordKey struct {
+	key string
+	day string
+}
+
+// Aggregator counts messages, users, sessions and labels of dialogs by day. It is safe for concurrent use.
+// Counts are kept in memory and periodically merged into store, so several instances can share one store.
+// Only counts and users first seen since the previous flush are merged.
+type Aggregator struct {
+	mux       sync.Mutex
+	store     Store
+	totals    map[recordKey]*Record
+	pending   map[recordKey]*Record
+	seen      map[string]*BloomFilter
+	seenSince map[string]*BloomFilter
+	sessions  map[string]time.Time
+	pruned    time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAggregator creates aggregator and loads saved statistics from store. Store may be nil to keep statistics in memory only.
+func NewAggregator(store Store) *Aggregator {
+	a := &Aggregator{
+		store:     store,
+		totals:    map[recordKey]*Record{},
+		pending:   map[recordKey]*Record{},
+		seen:      map[string]*BloomFilter{},
+		seenSince: map[string]*BloomFilter{},
+		sessions:  map[string]time.Time{},
+		pruned:    time.Now(),
+	}
+	if store != nil {
+		records, err := store.Load()
+		if err != nil {
+			logger.Errorf("Cannot load statistics: %v", err)
+		}
+		for _, record := range records {
+			add(a.totals, record)
+		}
+		seen, err := store.LoadSeen()
+		if err != nil {
+			logger.Errorf("Cannot load seen users: %v", err)
+		}
+		for key, filter := range seen {
+			a.seen[key] = filter
+		}
+	}
+	return a
+}
+
+// Add counts message of user to dialog with key. Zero time of event means now.
+func (a *Aggregator) Add(key string, event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	day := event.At.In(Location).Format(dayLayout)
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	delta := Record{Messages: 1, Labels: map[string]int{}}
+	for _, label := range event.Labels {
+		delta.Labels[label]++
+	}
+
+	seen, ok := a.seen[key]
+	if !ok {
+		seen = NewBloomFilter()
+		a.seen[key] = seen
+	}
+	if !seen.Add(event.UserID) {
+		delta.NewUsers = 1
+		if a.store != nil {
+			since, ok := a.seenSince[key]
+			if !ok {
+				since = NewBloomFilter()
+				a.seenSince[key] = since
+			}
+			since.Add(event.UserID)
+		}
+	}
+
+	sessionKey := key + "|" + event.SessionID
+	last, tracked := a.sessions[sessionKey]
+	if event.NewSession || !tracked || event.At.Sub(last) > SessionTimeout {
+		delta.Sessions = 1
+	} else if event.At.After(last) {
+		delta.SessionSeconds = event.At.Sub(last).Seconds()
+	}
+	a.sessions[sessionKey] = event.At
+	a.pruneSessions(event.At)
+
+	addMessage(a.totals, key, day, event.UserID, delta)
+	if a.store != nil {
+		addMessage(a.pending, key, day, event.UserID, delta)
+	}
+}
+
+func addMessage(records map[recordKey]*Record, key string, day string, userID string, delta Record) {
+	k := recordKey{key, day}
+	record, ok := records[k]
+	if !ok {
+		record = newRecord(key, day)
+		records[k] = record
+	}
+	record.Users.Add(userID)
+	record.Messages += delta.Messages
+	record.NewUsers += delta.NewUsers
+	record.Sessions += delta.Sessions
+	record.SessionSeconds += delta.SessionSeconds
+	for label, count := range delta.Labels {
+		record.Labels[label] += count
+	}
+}
+
+func add(records map[recordKey]*Record, record Record) {
+	k := recordKey{record.Key, record.Day}
+	existing, ok := records[k]
+	if !ok {
+		existing = newRecord(record.Key, record.Day)
+		records[k] = existing
+	}
+	existing.Merge(record)
+}
+
+// pruneSessions forgets sessions inactive longer than SessionTimeout, once a minute.
+func (a *Aggregator) pruneSessions(now time.Time) {
+	if now.Sub(a.pruned) < time.Minute {
+		return
+	}
+	a.pruned = now
+	for key, last := range a.sessions {
+		if now.Sub(last) > SessionTimeout {
+			delete(a.sessions, key)
+		}
+	}
+}
+
+// Flush merges statistics counted since previous flush into store.
+func (a *Aggregator) Flush() error {
+	if a.store == nil {
+		return nil
+	}
+	a.mux.Lock()
+	pending := a.pending
+	a.pending = map[recordKey]*Record{}
+	seen := a.seenSince
+	a.seenSince = map[string]*BloomFilter{}
+	a.mux.Unlock()
+
+	var records []Record
+	for _, record := range pending {
+		records = append(records, *record)
+	}
+	for i, record := range records {
+		if err := a.store.Merge(record); err != nil {
+			// return not merged statistics back to be merged by the next flush
+			a.mux.Lock()
+			for _, r := range records[i:] {
+				add(a.pending, r)
+			}
+			a.restoreSeen(seen)
+			a.mux.Unlock()
+			return err
+		}
+	}
+	for key, filter := range seen {
+		if err := a.store.MergeSeen(key, filter); err != nil {
+			// merging of seen users is idempotent, so already merged ones are returned too
+			a.mux.Lock()
+			a.restoreSeen(seen)
+			a.mux.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSeen returns users seen since the last flush back to be merged by the next flush. Lock should be held.
+func (a *Aggregator) restoreSeen(seen map[string]*BloomFilter) {
+	for key, filter := range seen {
+		if since, ok := a.seenSince[key]; ok {
+			since.Merge(filter)
+		} else {
+			a.seenSince[key] = filter
+		}
+	}
+}
+
+// Start flushes statistics to store with interval until Close is called.
+func (a *Aggregator) Start(interval time.Duration) {
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := a.Flush(); err != nil {
+					logger.Errorf("Cannot flush statistics: %v", err)
+				}
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops periodic flushes and flushes remaining statistics.
+func (a *Aggregator) Close(ctx context.Context) error {
+	if a.stop != nil {
+		close(a.stop)
+		select {
+		case <-a.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return a.Flush()
+}
+
+// DaySummary is statistics of dialog for a day.
+type DaySummary struct {
+	Messages int `json:"messages"`
+	Users    int `json:"users"`
+}
+
+// Summary is statistics of dialog for all time. Users is an estimated number of unique users.
+type Summary struct {
+	TotalMessages int                   `json:"totalMessages"`
+	TotalUsers    int                   `json:"totalUsers"`
+	Days          map[string]DaySummary `json:"days"`
+}
+
+// Summary returns statistics of all dialogs by key.
+func (a *Aggregator) Summary() map[string]Summary {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	summaries := map[string]Summary{}
+	users := map[string]*HyperLogLog{}
+	for k, record := range a.totals {
+		summary, ok := summaries[k.key]
+		if !ok {
+			summary = Summary{Days: map[string]DaySummary{}}
+			users[k.key] = NewHyperLogLog()
+		}
+		summary.TotalMessages += record.Messages
+		summary.Days[k.day] = DaySummary{Messages: record.Messages, Users: record.Users.Count()}
+		users[k.key].Merge(record.Users)
+		summaries[k.key] = summary
+	}
+	for key, summary := range summaries {
+		summary.TotalUsers = users[key].Count()
+		summaries[key] = summary
+	}
+	return summaries
+}
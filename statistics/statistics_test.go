@@ -0,0 +1,180 @@
+package statistics
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// memoryStore merges statistics like MongoStore does. Merges fail while failing is set.
+type memoryStore struct {
+	records map[recordKey]*Record
+	seen    map[string]*BloomFilter
+	merges  int
+	failing bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: map[recordKey]*Record{}, seen: map[string]*BloomFilter{}}
+}
+
+func (s *memoryStore) Load() ([]Record, error) {
+	var records []Record
+	for _, record := range s.records {
+		records = append(records, *record)
+	}
+	return records, nil
+}
+
+func (s *memoryStore) Merge(record Record) error {
+	if s.failing {
+		return errors.New("store is not available")
+	}
+	s.merges++
+	add(s.records, record)
+	return nil
+}
+
+func (s *memoryStore) LoadSeen() (map[string]*BloomFilter, error) {
+	return s.seen, nil
+}
+
+func (s *memoryStore) MergeSeen(key string, seen *BloomFilter) error {
+	if s.failing {
+		return errors.New("store is not available")
+	}
+	if _, ok := s.seen[key]; !ok {
+		s.seen[key] = NewBloomFilter()
+	}
+	s.seen[key].Merge(seen)
+	return nil
+}
+
+func at(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, Location)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestDayRollover(t *testing.T) {
+	a := NewAggregator(nil)
+	a.Add("/test", Event{UserID: "alice", SessionID: "1", NewSession: true, At: at("2020-04-01 23:50")})
+	a.Add("/test", Event{UserID: "alice", SessionID: "1", At: at("2020-04-01 23:59")})
+	a.Add("/test", Event{UserID: "alice", SessionID: "1", At: at("2020-04-02 00:01")})
+	a.Add("/test", Event{UserID: "bob", SessionID: "2", NewSession: true, At: at("2020-04-02 00:02")})
+
+	points, total := a.Series(func(key string) bool { return key == "/test" }, at("2020-04-01 00:00"), at("2020-04-02 00:00"), Day)
+	if len(points) != 2 {
+		t.Fatalf("expected 2 days, got %+v", points)
+	}
+	first, second := points[0], points[1]
+	if first.Period != "2020-04-01" || first.Messages != 2 || first.ActiveUsers != 1 || first.NewUsers != 1 || first.Sessions != 1 {
+		t.Errorf("unexpected first day %+v", first)
+	}
+	// session continued after midnight is counted on the day it started, returning user is not new
+	if second.Period != "2020-04-02" || second.Messages != 2 || second.ActiveUsers != 2 || second.NewUsers != 1 ||
+		second.ReturningUsers != 1 || second.Sessions != 1 {
+		t.Errorf("unexpected second day %+v", second)
+	}
+	if first.AvgSessionSeconds != 9*60 || second.AvgSessionSeconds != 2*60 {
+		t.Errorf("expected session time split by days, got %v and %v", first.AvgSessionSeconds, second.AvgSessionSeconds)
+	}
+	if total.Messages != 4 || total.ActiveUsers != 2 || total.NewUsers != 2 || total.Sessions != 2 {
+		t.Errorf("unexpected total %+v", total)
+	}
+
+	// events are split by days of Moscow time zone
+	a.Add("/test", Event{UserID: "alice", SessionID: "3", At: time.Date(2020, 4, 2, 21, 30, 0, 0, time.UTC)})
+	if summary := a.Summary()["/test"]; summary.Days["2020-04-03"].Messages != 1 || summary.TotalMessages != 5 || summary.TotalUsers != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	a := NewAggregator(nil)
+	a.Add("/test", Event{UserID: "alice", SessionID: "1", At: at("2020-04-01 10:00")})
+	a.Add("/test", Event{UserID: "alice", SessionID: "1", At: at("2020-04-01 10:10")})
+	a.Add("/test", Event{UserID: "alice", SessionID: "1", At: at("2020-04-01 11:00")})
+	_, total := a.Series(func(string) bool { return true }, at("2020-04-01 00:00"), at("2020-04-01 00:00"), Day)
+	if total.Sessions != 2 || total.MessagesPerSession != 1.5 {
+		t.Errorf("expected session to end after inactivity, got %+v", total)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	a := NewAggregator(nil)
+	for day := 1; day <= 14; day++ {
+		event := Event{UserID: "user-" + strconv.Itoa(day%3), SessionID: strconv.Itoa(day), Labels: []string{"command:help"},
+			At: time.Date(2020, 4, day, 12, 0, 0, 0, Location)}
+		a.Add("/api/dialogs/test", event)
+		a.Add("/api/dialogs/other", event)
+	}
+
+	// 2020-04-01 is Wednesday
+	points, total := a.Series(func(key string) bool { return key == "/api/dialogs/test" },
+		at("2020-04-01 00:00"), at("2020-04-20 00:00"), Week)
+	periods := []string{"2020-03-30", "2020-04-06", "2020-04-13", "2020-04-20"}
+	messages := []int{5, 7, 2, 0}
+	if len(points) != len(periods) {
+		t.Fatalf("expected %d weeks, got %+v", len(periods), points)
+	}
+	for i, point := range points {
+		if point.Period != periods[i] || point.Messages != messages[i] || point.Labels["command:help"] != messages[i] {
+			t.Errorf("expected week %s with %d messages, got %+v", periods[i], messages[i], point)
+		}
+	}
+	if total.Period != "2020-04-01..2020-04-20" || total.Messages != 14 || total.ActiveUsers != 3 || total.NewUsers != 3 {
+		t.Errorf("unexpected total %+v", total)
+	}
+
+	points, _ = a.Series(func(string) bool { return true }, at("2020-04-01 00:00"), at("2020-05-01 00:00"), Month)
+	if len(points) != 2 || points[0].Period != "2020-04" || points[0].Messages != 28 || points[1].Messages != 0 {
+		t.Errorf("unexpected months %+v", points)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	store := newMemoryStore()
+	a := NewAggregator(store)
+	a.Add("/test", Event{UserID: "alice", SessionID: "1", Labels: []string{"state:main"}, At: at("2020-04-01 10:00")})
+	a.Add("/test", Event{UserID: "bob", SessionID: "2", At: at("2020-04-01 10:00")})
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	record := store.records[recordKey{"/test", "2020-04-01"}]
+	if record == nil || record.Messages != 2 || record.NewUsers != 2 || record.Users.Count() != 2 || record.Labels["state:main"] != 1 {
+		t.Fatalf("expected flushed record, got %+v", record)
+	}
+
+	// nothing is merged again
+	if err := a.Flush(); err != nil || store.merges != 1 {
+		t.Errorf("expected no merges without new events, got %d merges, error %v", store.merges, err)
+	}
+
+	// statistics failed to flush are merged by the next flush
+	store.failing = true
+	a.Add("/test", Event{UserID: "carol", SessionID: "3", At: at("2020-04-01 11:00")})
+	if err := a.Flush(); err == nil {
+		t.Fatal("expected error of store")
+	}
+	store.failing = false
+	a.Add("/test", Event{UserID: "carol", SessionID: "3", At: at("2020-04-01 11:01")})
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if record.Messages != 4 || record.NewUsers != 3 || record.Sessions != 3 || record.Users.Count() != 3 {
+		t.Errorf("expected statistics to be merged once, got %+v", record)
+	}
+
+	// statistics and seen users of another instance are loaded from store
+	other := NewAggregator(store)
+	other.Add("/test", Event{UserID: "carol", SessionID: "4", At: at("2020-04-02 10:00")})
+	other.Add("/test", Event{UserID: "dave", SessionID: "5", At: at("2020-04-02 10:00")})
+	_, total := other.Series(func(string) bool { return true }, at("2020-04-01 00:00"), at("2020-04-02 00:00"), Day)
+	if total.Messages != 6 || total.NewUsers != 4 || total.ActiveUsers != 4 {
+		t.Errorf("expected saved statistics with new events, got %+v", total)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"yandex-dialogs/auth"
+	"yandex-dialogs/statistics"
+)
+
+type statisticsResponse struct {
+	statistics.Summary
+	RejectedRequests int `json:"rejectedRequests"`
+}
+
+func handleStatisticsRequest(stats *statistics.Aggregator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCorsHeaders(w)
+
+		responseStatistics := map[string]statisticsResponse{}
+		for k, v := range stats.Summary() {
+			responseStatistics[k] = statisticsResponse{Summary: v}
+		}
+		for k, v := range auth.Rejections.Snapshot() {
+			response, ok := responseStatistics[k]
+			if !ok {
+				response.Days = map[string]statistics.DaySummary{}
+			}
+			response.RejectedRequests = v
+			responseStatistics[k] = response
+		}
+		writeJson(w, http.StatusOK, responseStatistics)
+	}
+}
+
+type seriesQuery struct {
+	from        time.Time
+	to          time.Time
+	granularity statistics.Granularity
+}
+
+// parseSeriesQuery reads days `from`..`to` (YYYY-MM-DD, last 30 days by default) and `granularity` (day, week or month).
+func parseSeriesQuery(r *http.Request) (seriesQuery, error) {
+	values := r.URL.Query()
+	granularity, err := statistics.ParseGranularity(values.Get("granularity"))
+	if err != nil {
+		return seriesQuery{}, err
+	}
+	query := seriesQuery{to: time.Now().In(statistics.Location), granularity: granularity}
+	if value := values.Get("to"); value != "" {
+		if query.to, err = statistics.ParseDay(value); err != nil {
+			return seriesQuery{}, errors.New("to should be a day in format YYYY-MM-DD")
+		}
+	}
+	query.from = query.to.AddDate(0, 0, -29)
+	if value := values.Get("from"); value != "" {
+		if query.from, err = statistics.ParseDay(value); err != nil {
+			return seriesQuery{}, errors.New("from should be a day in format YYYY-MM-DD")
+		}
+	}
+	if query.from.After(query.to) || query.to.Sub(query.from) > 3*366*24*time.Hour {
+		return seriesQuery{}, errors.New("from should be before to and within 3 years from it")
+	}
+	return query, nil
+}
+
+func (q seriesQuery) series(stats *statistics.Aggregator, dialog Dialog) seriesResponse {
+	points, total := stats.Series(func(key string) bool {
+		return key == dialog.GetPath()
+	}, q.from, q.to, q.granularity)
+	return seriesResponse{
+		Dialog:      dialogName(dialog),
+		From:        q.from.Format("2006-01-02"),
+		To:          q.to.Format("2006-01-02"),
+		Granularity: q.granularity,
+		Points:      points,
+		Total:       total,
+	}
+}
+
+type seriesResponse struct {
+	Dialog      string                 `json:"dialog"`
+	From        string                 `json:"from"`
+	To          string                 `json:"to"`
+	Granularity statistics.Granularity `json:"granularity"`
+	Points      []statistics.Point     `json:"points"`
+	Total       statistics.Point       `json:"total"`
+}
+
+// handleSeriesRequest reports statistics of dialog by name, which is the last element of dialog path, split by periods.
+func handleSeriesRequest(dialogs []Dialog, stats *statistics.Aggregator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCorsHeaders(w)
+
+		dialog := findDialog(dialogs, mux.Vars(r)["dialog"])
+		if dialog == nil {
+			writeJson(w, http.StatusNotFound, map[string]string{"error": "Dialog not found"})
+			return
+		}
+		query, err := parseSeriesQuery(r)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJson(w, http.StatusOK, query.series(stats, dialog))
+	}
+}
+
+// handleExportRequest exports statistics of dialog from `dialog` parameter, or of all dialogs, for reporting.
+// Format is `json` (default) or `csv`, with a row per dialog and period and a column per reported label.
+func handleExportRequest(dialogs []Dialog, stats *statistics.Aggregator) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCorsHeaders(w)
+
+		selected := dialogs
+		if name := r.URL.Query().Get("dialog"); name != "" {
+			dialog := findDialog(dialogs, name)
+			if dialog == nil {
+				writeJson(w, http.StatusNotFound, map[string]string{"error": "Dialog not found"})
+				return
+			}
+			selected = []Dialog{dialog}
+		}
+		query, err := parseSeriesQuery(r)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		var series []seriesResponse
+		for _, v := range selected {
+			series = append(series, query.series(stats, v))
+		}
+
+		filename := fmt.Sprintf("statistics_%s_%s", query.from.Format("2006-01-02"), query.to.Format("2006-01-02"))
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+			writeJson(w, http.StatusOK, series)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+			w.WriteHeader(http.StatusOK)
+			writeSeriesCsv(w, series)
+		default:
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "format should be json or csv"})
+		}
+	}
+}
+
+func writeSeriesCsv(w http.ResponseWriter, series []seriesResponse) {
+	labelSet := map[string]bool{}
+	for _, s := range series {
+		for _, point := range s.Points {
+			for label := range point.Labels {
+				labelSet[label] = true
+			}
+		}
+	}
+	var labels []string
+	for label := range labelSet {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	writer := csv.NewWriter(w)
+	header := []string{"dialog", "period", "messages", "activeUsers", "newUsers", "returningUsers",
+		"sessions", "messagesPerSession", "avgSessionSeconds"}
+	writer.Write(append(header, labels...))
+	for _, s := range series {
+		for _, point := range s.Points {
+			row := []string{s.Dialog, point.Period, strconv.Itoa(point.Messages), strconv.Itoa(point.ActiveUsers),
+				strconv.Itoa(point.NewUsers), strconv.Itoa(point.ReturningUsers), strconv.Itoa(point.Sessions),
+				strconv.FormatFloat(point.MessagesPerSession, 'f', 2, 64),
+				strconv.FormatFloat(point.AvgSessionSeconds, 'f', 1, 64)}
+			for _, label := range labels {
+				row = append(row, strconv.Itoa(point.Labels[label]))
+			}
+			writer.Write(row)
+		}
+	}
+	writer.Flush()
+}
+
+func findDialog(dialogs []Dialog, name string) Dialog {
+	for _, v := range dialogs {
+		if dialogName(v) == name {
+			return v
+		}
+	}
+	return nil
+}
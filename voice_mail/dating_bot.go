@@ -1,23 +1,24 @@
 package voice_mail
 
 import (
-	"log"
 	"math/rand"
 	"time"
+	"yandex-dialogs/metrics"
 )
 
 type DatingBot struct {
-	mailService *MailService
+	mailService MailService
 }
 
-func NewDatingBot(service *MailService) DatingBot {
+func NewDatingBot(service MailService) DatingBot {
 	return DatingBot{mailService: service}
 }
 
 func (m DatingBot) CheckMails() {
-	log.Print("Run Dating cron")
+	logger.Debugf("Run Dating cron")
 	sentMessages := map[int]map[int]struct{}{}
 	messages := m.mailService.GetMessagesForUser(&User{Number: 7070})
+	metrics.VoiceMailQueueDepth.Set(float64(len(messages)), "7070")
 	freeDateUsers := m.mailService.GetDateFreeUsers()
 	rand.Seed(time.Now().UnixNano())
 	for _, message := range messages {
@@ -32,7 +33,7 @@ func (m DatingBot) CheckMails() {
 				message.To = user.Number
 				err := m.mailService.SendMessage(&message)
 				if err != nil {
-					log.Printf("Error with loop %v", err)
+					logger.Errorf("Cannot send dating message from %d to %d: %v", message.From, message.To, err)
 					continue
 				}
 				if _, ok := sentMessages[message.From]; !ok {
@@ -1,69 +1,80 @@
 package voice_mail
 
 import (
-	"errors"
 	"github.com/go-bongo/bongo"
 	"gopkg.in/mgo.v2/bson"
-	"log"
 	"net"
+	"time"
 	"yandex-dialogs/common"
+	"yandex-dialogs/logging"
+	"yandex-dialogs/metrics"
 )
 
-var mongoConnection = common.GetEnv("MONGO_CONNECTION", "")
-var databaseName = common.GetEnv("DATABASE_NAME", "voice-mail")
-var encryptKey = common.GetEnv("ENCRYPT_KEY", "")
+// MailService stores users of voice mail and messages between them.
+type MailService interface {
+	// Ping checks DB of service, restoring broken connection to it.
+	Ping() error
+	SaveUser(user *User) error
+	// FindUser returns nil user without error if user is not found.
+	FindUser(userId string) (*User, error)
+	// FindUserByNumber returns nil user without error if user is not found.
+	FindUserByNumber(number int) (*User, error)
+	// CheckAndGenerateId returns free number, starting from the given one. Returns false if free number is not found in 10 attempts.
+	CheckAndGenerateId(number int) (int, error, bool)
+	GetDateFreeUsers() []User
+	GetReviewUsers() []User
+	// SendMessage saves message, if recipient exists and sender is not in black list of recipient.
+	SendMessage(message *Message) error
+	// ReadMessage returns the oldest message of user and removes it. Returns nil if there are no messages.
+	ReadMessage(user *User) *Message
+	GetMessagesForUser(user *User) []Message
+	DeleteMessage(message *Message) error
+}
 
-type MailService struct {
+// MongoMailService keeps users and messages in MongoDB.
+type MongoMailService struct {
 	connection *bongo.Connection
+	mongo      *common.Connections
 }
 
-func NewMailService() *MailService {
-	config := &bongo.Config{
-		ConnectionString: mongoConnection,
-		Database:         databaseName,
-	}
-	connection, err := bongo.Connect(config)
+func NewMongoMailService(deps *common.Dependencies) (*MongoMailService, error) {
+	settings := deps.Config.Dialogs.VoiceMail
+	connection, err := deps.Mongo.Get(settings.MongoConnection, settings.DatabaseName)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	connection.Session.SetPoolLimit(50)
-	return &MailService{connection: connection}
+	return &MongoMailService{connection: connection, mongo: deps.Mongo}, nil
 }
 
-func (m MailService) Reconnect() {
-	err := m.connection.Connect()
-	if err != nil {
-		log.Print(err)
-	}
-	m.connection.Session.SetPoolLimit(50)
+func (m MongoMailService) Ping() error {
+	return m.mongo.Ping(m.connection)
 }
 
-func (m MailService) Ping() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Print("Recovered in f", r)
-			err = errors.New("Error ping")
-		}
-	}()
-	err = m.connection.Session.Ping()
-	return err
+func (m MongoMailService) SaveUser(user *User) error {
+	defer metrics.ObserveMongo("users", "save", time.Now())
+	return m.connection.Collection("users").Save(user)
 }
 
-func (m MailService) SaveUser(user *User) error {
-	return m.connection.Collection("users").Save(user)
+func (m MongoMailService) SendMessage(message *Message) error {
+	toUser, _ := m.FindUserByNumber(message.To)
+	if !canDeliver(toUser, message) {
+		return nil
+	}
+	defer metrics.ObserveMongo("messages", "save", time.Now())
+	return m.connection.Collection("messages").Save(message)
 }
 
-func (m MailService) SendMessage(message *Message) error {
-	toUser, _ := m.findUserByNumber(message.To)
+// canDeliver checks that recipient of message exists or is a service number, and sender is not in black list of recipient.
+func canDeliver(toUser *User, message *Message) bool {
 	if toUser == nil && message.To != 7070 && message.To != 8800 && message.To != 1000 {
-		log.Printf("Message from user %d didn't send to user %d because user doesn't exist", message.From, message.To)
-		return nil
+		logger.Infof("Message from user %d didn't send to user %d because user doesn't exist", message.From, message.To)
+		return false
 	}
 	if toUser != nil && contains(toUser.BlackList, message.From) {
-		log.Printf("Message from user %d didn't send to user %d because of blacklist", message.From, message.To)
-		return nil
+		logger.Infof("Message from user %d didn't send to user %d because of blacklist", message.From, message.To)
+		return false
 	}
-	return m.connection.Collection("messages").Save(message)
+	return true
 }
 
 func contains(s []int, e int) bool {
@@ -75,25 +86,30 @@ func contains(s []int, e int) bool {
 	return false
 }
 
-func (m MailService) ReadMessage(user *User) *Message {
+func (m MongoMailService) ReadMessage(user *User) *Message {
 	message := &Message{}
+	start := time.Now()
 	err := m.connection.Collection("messages").FindOne(bson.M{"to": user.Number}, message)
+	metrics.ObserveMongo("messages", "find", start)
 
 	if err != nil {
-		log.Printf("Messages for user %d not found", user.Number)
+		logger.Debugf("Messages for user %d not found", user.Number)
 		return nil
 	}
 
+	start = time.Now()
 	err = m.connection.Collection("messages").DeleteDocument(message)
+	metrics.ObserveMongo("messages", "delete", start)
 	if err != nil {
-		log.Printf("Error: %v", err)
+		logger.Errorf("Cannot delete read message %v: %v", message.GetId(), err)
 	}
-	log.Printf("Found message %v for user %d. Removed.", message.GetId(), user.Number)
+	logger.Debugf("Found message %v for user %d. Removed.", message.GetId(), user.Number)
 
 	return message
 }
 
-func (m MailService) GetMessagesForUser(user *User) []Message {
+func (m MongoMailService) GetMessagesForUser(user *User) []Message {
+	defer metrics.ObserveMongo("messages", "find", time.Now())
 	results := m.connection.Collection("messages").Find(bson.M{"to": user.Number})
 	var messages []Message
 	message := &Message{}
@@ -103,39 +119,42 @@ func (m MailService) GetMessagesForUser(user *User) []Message {
 	return messages
 }
 
-func (m MailService) findUser(userId string) (*User, error) {
+func (m MongoMailService) FindUser(userId string) (*User, error) {
 	user := &User{}
+	defer metrics.ObserveMongo("users", "find", time.Now())
 	err := m.connection.Collection("users").FindOne(bson.M{"id": userId}, user)
 
 	if err != nil {
 		if _, ok := err.(*net.OpError); ok {
 			return nil, err
 		}
-		log.Printf("User %s not found", userId)
+		logger.Debugf("User %s not found", logging.ID(userId))
 		return nil, nil
 	} else {
-		log.Printf("Found user: %+v", user)
+		logger.Debugf("Found user %d", user.Number)
 	}
 	return user, nil
 }
 
-func (m MailService) findUserByNumber(number int) (*User, error) {
+func (m MongoMailService) FindUserByNumber(number int) (*User, error) {
 	user := &User{}
+	defer metrics.ObserveMongo("users", "find", time.Now())
 	err := m.connection.Collection("users").FindOne(bson.M{"number": number}, user)
 
 	if err != nil {
 		if _, ok := err.(*net.OpError); ok {
 			return nil, err
 		}
-		log.Printf("User %d not found", number)
+		logger.Debugf("User %d not found", number)
 		return nil, nil
 	} else {
-		log.Printf("Found user: %+v", user)
+		logger.Debugf("Found user %d", user.Number)
 	}
 	return user, nil
 }
 
-func (m MailService) GetDateFreeUsers() []User {
+func (m MongoMailService) GetDateFreeUsers() []User {
+	defer metrics.ObserveMongo("users", "find", time.Now())
 	results := m.connection.Collection("users").Find(bson.M{"datefree": true})
 	var users []User
 	user := &User{}
@@ -145,7 +164,8 @@ func (m MailService) GetDateFreeUsers() []User {
 	return users
 }
 
-func (m MailService) GetReviewUsers() []User {
+func (m MongoMailService) GetReviewUsers() []User {
+	defer metrics.ObserveMongo("users", "find", time.Now())
 	results := m.connection.Collection("users").Find(bson.M{"reviewed": true})
 	var users []User
 	user := &User{}
@@ -155,15 +175,17 @@ func (m MailService) GetReviewUsers() []User {
 	return users
 }
 
-func (m MailService) checkAndGenerateId(number int) (int, error, bool) {
+func (m MongoMailService) CheckAndGenerateId(number int) (int, error, bool) {
 	for i := 0; i < 10; i++ {
 		user := &User{}
+		start := time.Now()
 		err := m.connection.Collection("users").FindOne(bson.M{"number": number}, user)
+		metrics.ObserveMongo("users", "find", start)
 		if err != nil {
 			if _, ok := err.(*bongo.DocumentNotFoundError); ok {
 				return number, nil, true
 			} else {
-				log.Print("real error " + err.Error())
+				logger.Errorf("Cannot check number %d: %v", number, err)
 				return 0, err, true
 			}
 		}
@@ -172,6 +194,7 @@ func (m MailService) checkAndGenerateId(number int) (int, error, bool) {
 	return 0, nil, false
 }
 
-func (m MailService) DeleteMessage(message *Message) error {
+func (m MongoMailService) DeleteMessage(message *Message) error {
+	defer metrics.ObserveMongo("messages", "delete", time.Now())
 	return m.connection.Collection("messages").DeleteDocument(message)
 }
@@ -1,41 +1,45 @@
 package voice_mail
 
 import (
-	"log"
 	"strconv"
-	"yandex-dialogs/masha"
+	"yandex-dialogs/metrics"
 )
 
+// ChatBot answers messages sent to bot number, like Masha skill does.
+type ChatBot interface {
+	GetAnswer(userID string, text string) (string, error)
+}
+
 type MashaBot struct {
-	mailService *MailService
-	mashaSkill  masha.Masha
+	mailService MailService
+	mashaSkill  ChatBot
 }
 
-func NewMashaBot(service *MailService) MashaBot {
-	mashaSkill := masha.NewMasha(5000)
+func NewMashaBot(service MailService, mashaSkill ChatBot) MashaBot {
 	return MashaBot{mailService: service, mashaSkill: mashaSkill}
 }
 
 func (m MashaBot) CheckMails() {
-	log.Print("Run Masha cron")
+	logger.Debugf("Run Masha cron")
 	messages := m.mailService.GetMessagesForUser(&User{Number: 8800})
+	metrics.VoiceMailQueueDepth.Set(float64(len(messages)), "8800")
 	for _, message := range messages {
-		log.Printf("Cron message from %d", message.From)
+		logger.Debugf("Masha answers message from %d", message.From)
 		question := message.Text
 		answer, err := m.mashaSkill.GetAnswer(strconv.Itoa(message.From), question)
 		if err != nil {
-			log.Print(err)
+			logger.Errorf("Cannot get answer of Masha for %d: %v", message.From, err)
 			continue
 		}
 		answerMessage := &Message{To: message.From, From: 8800, Text: answer}
 		err = m.mailService.SendMessage(answerMessage)
 		if err != nil {
-			log.Print(err)
+			logger.Errorf("Cannot send answer of Masha to %d: %v", message.From, err)
 			continue
 		}
 		err = m.mailService.DeleteMessage(&message)
 		if err != nil {
-			log.Printf("Error: %v", err)
+			logger.Errorf("Cannot delete message answered by Masha: %v", err)
 		}
 	}
 }
@@ -0,0 +1,28 @@
+package voice_mail
+
+import (
+	"testing"
+)
+
+type fakeChatBot struct{}
+
+func (b fakeChatBot) GetAnswer(userID string, text string) (string, error) {
+	return "Ответ для " + userID + ": " + text, nil
+}
+
+func TestMashaBotAnswers(t *testing.T) {
+	service := NewMemoryMailService()
+	user := &User{Id: "alice", Number: 11111}
+	service.SaveUser(user)
+	service.SendMessage(&Message{From: user.Number, To: 8800, Text: "Привет"})
+
+	NewMashaBot(service, fakeChatBot{}).CheckMails()
+
+	if messages := service.GetMessagesForUser(&User{Number: 8800}); len(messages) != 0 {
+		t.Errorf("expected messages to Masha to be handled, got %+v", messages)
+	}
+	messages := service.GetMessagesForUser(user)
+	if len(messages) != 1 || messages[0].From != 8800 || messages[0].Text != "Ответ для 11111: Привет" {
+		t.Errorf("expected answer of Masha, got %+v", messages)
+	}
+}
@@ -0,0 +1,169 @@
+package voice_mail
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2/bson"
+	"sync"
+)
+
+// MemoryMailService keeps users and messages in process memory. It is used in tests and is safe for concurrent use.
+// Users and messages are copied on save and load, so changes are not visible until saved, as with DB.
+type MemoryMailService struct {
+	mux      sync.Mutex
+	users    []*User
+	messages []*Message
+}
+
+func NewMemoryMailService() *MemoryMailService {
+	return &MemoryMailService{}
+}
+
+func (m *MemoryMailService) Ping() error {
+	return nil
+}
+
+func (m *MemoryMailService) SaveUser(user *User) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if user.GetId() == "" {
+		user.SetId(bson.NewObjectId())
+	}
+	for i, u := range m.users {
+		if u.GetId() == user.GetId() {
+			m.users[i] = copyUser(user)
+			return nil
+		}
+	}
+	m.users = append(m.users, copyUser(user))
+	return nil
+}
+
+func (m *MemoryMailService) FindUser(userId string) (*User, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for _, u := range m.users {
+		if u.Id == userId {
+			return copyUser(u), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryMailService) FindUserByNumber(number int) (*User, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.findUserByNumber(number), nil
+}
+
+func (m *MemoryMailService) findUserByNumber(number int) *User {
+	for _, u := range m.users {
+		if u.Number == number {
+			return copyUser(u)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryMailService) CheckAndGenerateId(number int) (int, error, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for i := 0; i < 10; i++ {
+		if m.findUserByNumber(number) == nil {
+			return number, nil, true
+		}
+		number++
+	}
+	return 0, nil, false
+}
+
+func (m *MemoryMailService) GetDateFreeUsers() []User {
+	return m.filterUsers(func(user *User) bool {
+		return user.DateFree
+	})
+}
+
+func (m *MemoryMailService) GetReviewUsers() []User {
+	return m.filterUsers(func(user *User) bool {
+		return user.Reviewed
+	})
+}
+
+func (m *MemoryMailService) filterUsers(filter func(user *User) bool) []User {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	var users []User
+	for _, u := range m.users {
+		if filter(u) {
+			users = append(users, *copyUser(u))
+		}
+	}
+	return users
+}
+
+func (m *MemoryMailService) SendMessage(message *Message) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if !canDeliver(m.findUserByNumber(message.To), message) {
+		return nil
+	}
+	if message.GetId() == "" {
+		message.SetId(bson.NewObjectId())
+	}
+	saved := *message
+	for i, msg := range m.messages {
+		if msg.GetId() == message.GetId() {
+			m.messages[i] = &saved
+			return nil
+		}
+	}
+	m.messages = append(m.messages, &saved)
+	return nil
+}
+
+func (m *MemoryMailService) ReadMessage(user *User) *Message {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for i, msg := range m.messages {
+		if msg.To == user.Number {
+			m.messages = append(m.messages[:i], m.messages[i+1:]...)
+			return msg
+		}
+	}
+	return nil
+}
+
+func (m *MemoryMailService) GetMessagesForUser(user *User) []Message {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	var messages []Message
+	for _, msg := range m.messages {
+		if msg.To == user.Number {
+			messages = append(messages, *msg)
+		}
+	}
+	return messages
+}
+
+func (m *MemoryMailService) DeleteMessage(message *Message) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for i, msg := range m.messages {
+		if msg.GetId() == message.GetId() {
+			m.messages = append(m.messages[:i], m.messages[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("message not found")
+}
+
+func copyUser(user *User) *User {
+	c := *user
+	c.BlackList = append([]int(nil), user.BlackList...)
+	if user.PhoneBook != nil {
+		c.PhoneBook = make(map[string]int, len(user.PhoneBook))
+		for name, number := range user.PhoneBook {
+			c.PhoneBook[name] = number
+		}
+	}
+	return &c
+}
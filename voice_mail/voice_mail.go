@@ -1,45 +1,103 @@
 package voice_mail
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/azzzak/alice"
 	"github.com/go-bongo/bongo"
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/robfig/cron/v3"
 	"hash/fnv"
-	"log"
 	"math/rand"
 	"net/http"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"yandex-dialogs/common"
+	"yandex-dialogs/fuzzy"
+	"yandex-dialogs/intents"
+	"yandex-dialogs/logging"
+	"yandex-dialogs/masha"
+	"yandex-dialogs/metrics"
+	"yandex-dialogs/nlu"
+	"yandex-dialogs/registry"
+	"yandex-dialogs/reply"
+	"yandex-dialogs/statistics"
 )
 
-var acceptWords = []string{"да", "давай", "можно", "плюс", "ага", "угу", "дэ"}
-var negativeWords = []string{"нет", "не", "не надо"}
-var helpWords = []string{"что ты умеешь", "help", "помог", "помощь", "что делать", "как", "не понятно", "не понял", "не понятно", "что дальше"}
-var nextWords = []string{"дальше", "еще", "ещё", "еше", "следующ", "продолж"}
-var cancelWords = []string{"отмена", "хватит", "все", "всё", "закончи", "закончить", "выход", "выйди", "выйти"}
-var newMessageWords = []string{"новое сообщение", "новое письмо", "отправить", "отправь", "письмо"}
+var logger = logging.For("voice_mail")
+
+var acceptWords = []string{"да", "давай*", "можно", "плюс", "ага", "угу", "дэ", "конечно"}
+var negativeWords = []string{"нет", "не надо", "не хочу", "не нужно"}
+var helpWords = []string{"что ты умеешь", "help", "помог*", "помощь", "что делать", "как", "не понятно", "не понял", "что дальше"}
+var nextWords = []string{"дальше", "еще", "еше", "следующ*", "продолж*"}
+var cancelWords = []string{"отмена", "отмени*", "хватит", "все", "закончи", "закончить", "выход", "выйди", "выйти"}
+var exitWords = []string{"закончить"}
+var newMessageWords = []string{"новое сообщение", "новое письмо", "отправить", "отправь", "письмо", "написать"}
 var sendWords = []string{"отправить", "отправляй", "запускай"}
-var phoneBookWord = []string{"книг", "записн", "книжк"}
+var phoneBookWord = []string{"книг*", "записн*", "книжк*"}
 var addPhoneBookWord = []string{"добавить", "запомни", "запиши", "добавь"}
-var replyWords = []string{"ответить", "ответ", "reply"}
-var repeatWords = []string{"повтор", "расслышал"}
+var replyWords = []string{"ответ*", "reply"}
+var repeatWords = []string{"повтор*", "расслышал*"}
 var checkMailWords = []string{"открой почту", "сообщения", "входящие", "проверь почту", "проверить почту", "что там у меня", "есть новые сообщения", "письма", "ящик", "проверь", "проверить"}
-var blackListWords = []string{"забань", "добавь в черный список", "черный список", "чёрный список"}
-var clearBlackListWords = []string{"очистить черный список", "очисти черный список", "очисть черный список", "очистить чёрный список"}
-var myNumberWords = []string{"мой номер", "какой номер", "меня номер"}
-var myTokenWords = []string{"токен", "секрет", "пароль", "токинг", "такен"}
-var reviewWords = []string{"отзыв", "предложение", "оценк"}
-var datingWords = []string{"знаком", "случайн", "рандом", "наугад"}
+var blackListWords = []string{"забань", "забанить", "черный список", "черного списка"}
+var clearBlackListWords = []string{"очист* черный список", "очист* список"}
+var myNumberWords = []string{"мой номер", "какой номер", "меня номер", "какой у меня номер"}
+var myTokenWords = []string{"токен*", "секрет*", "пароль"}
+var reviewWords = []string{"отзыв*", "предложени*", "оценк*"}
+var datingWords = []string{"знаком*", "случайн*", "рандом*", "наугад"}
+
+var runSkillWords = []string{"говорящ* почт*", "запусти навык"}
+
+const (
+	acceptCommand         = "accept"
+	negativeCommand       = "negative"
+	helpCommand           = "help"
+	nextCommand           = "next"
+	cancelCommand         = "cancel"
+	exitCommand           = "exit"
+	newMessageCommand     = "new_message"
+	sendCommand           = "send"
+	phoneBookCommand      = "phone_book"
+	addPhoneBookCommand   = "add_phone_book"
+	replyCommand          = "reply"
+	repeatCommand         = "repeat"
+	checkMailCommand      = "check_mail"
+	blackListCommand      = "black_list"
+	clearBlackListCommand = "clear_black_list"
+	myNumberCommand       = "my_number"
+	myTokenCommand        = "my_token"
+	reviewCommand         = "review"
+	datingCommand         = "dating"
+	runSkillCommand       = "run_skill"
+)
 
-var runSkillWords = []string{"говорящая почта", "говорящую почту", "говорящей почты", "запусти навык"}
+var commands = intents.NewMatcher(
+	intents.Intent{Name: clearBlackListCommand, Phrases: clearBlackListWords, Priority: 90},
+	intents.Intent{Name: blackListCommand, Phrases: blackListWords, Priority: 80},
+	intents.Intent{Name: addPhoneBookCommand, Phrases: addPhoneBookWord, Priority: 70},
+	intents.Intent{Name: myTokenCommand, Phrases: myTokenWords, Priority: 65},
+	intents.Intent{Name: myNumberCommand, Phrases: myNumberWords, Priority: 65},
+	intents.Intent{Name: checkMailCommand, Phrases: checkMailWords, Priority: 60},
+	intents.Intent{Name: newMessageCommand, Phrases: newMessageWords, Priority: 55},
+	intents.Intent{Name: phoneBookCommand, Phrases: phoneBookWord, Priority: 50},
+	intents.Intent{Name: reviewCommand, Phrases: reviewWords, Priority: 45},
+	intents.Intent{Name: datingCommand, Phrases: datingWords, Priority: 45},
+	intents.Intent{Name: replyCommand, Phrases: replyWords, Priority: 40},
+	intents.Intent{Name: repeatCommand, Phrases: repeatWords, Priority: 40},
+	intents.Intent{Name: helpCommand, Phrases: helpWords, Priority: 30},
+	intents.Intent{Name: exitCommand, Phrases: exitWords, Priority: 25, Exact: true},
+	intents.Intent{Name: negativeCommand, Phrases: negativeWords, Priority: 20},
+	intents.Intent{Name: cancelCommand, Phrases: cancelWords, Priority: 15},
+	intents.Intent{Name: nextCommand, Phrases: nextWords, Priority: 12},
+	intents.Intent{Name: acceptCommand, Phrases: acceptWords, Priority: 10},
+	intents.Intent{Name: sendCommand, Phrases: sendWords, Priority: 10},
+	intents.Intent{Name: runSkillCommand, Phrases: runSkillWords},
+)
 
 type User struct {
 	bongo.DocumentBase `bson:",inline"`
@@ -62,9 +120,8 @@ type Message struct {
 }
 
 type UserState struct {
-	user    *User
-	state   string
-	context *Message
+	State   string   `json:"state"`
+	Context *Message `json:"context,omitempty"`
 }
 
 type MailBot interface {
@@ -73,55 +130,99 @@ type MailBot interface {
 }
 
 type VoiceMail struct {
-	states      map[string]*UserState
+	path        string
+	skillID     string
+	states      common.SessionStore
 	mux         sync.Mutex
-	mailService *MailService
+	mailService MailService
+	cron        *cron.Cron
+}
+
+const defaultPath = "/api/dialogs/voice-mail"
+
+func init() {
+	registry.Register("voice-mail", defaultPath, func(path string, options registry.Options) (registry.Dialog, error) {
+		voiceMail := NewVoiceMail()
+		voiceMail.path = path
+		return voiceMail, nil
+	})
+}
+
+func NewVoiceMail() *VoiceMail {
+	return &VoiceMail{path: defaultPath}
 }
 
-func NewVoiceMail() VoiceMail {
-	mailService := NewMailService()
-	initBots(mailService)
-	return VoiceMail{
-		states:      map[string]*UserState{},
-		mailService: mailService,
+// NewVoiceMailWithService creates dialog keeping users and messages in service instead of MongoDB.
+func NewVoiceMailWithService(service MailService) *VoiceMail {
+	return &VoiceMail{path: defaultPath, mailService: service}
+}
+
+func (v *VoiceMail) Init(deps *common.Dependencies) error {
+	if v.mailService == nil {
+		if deps.Config.Dialogs.VoiceMail.Store == "memory" {
+			v.mailService = NewMemoryMailService()
+		} else {
+			mailService, err := NewMongoMailService(deps)
+			if err != nil {
+				return err
+			}
+			v.mailService = mailService
+		}
 	}
+	v.skillID = deps.Config.Dialogs.VoiceMail.SkillID
+	v.states = deps.SessionStore("voice_mail")
+
+	mashaSkill := masha.NewMasha(5000)
+	if err := mashaSkill.Init(deps); err != nil {
+		return err
+	}
+	v.cron = cron.New()
+	initBots(v.cron, v.mailService, mashaSkill)
+	v.cron.Start()
+	return nil
+}
+
+// Close waits for running bots, so messages are not left half-processed.
+func (v *VoiceMail) Close(ctx context.Context) error {
+	return common.StopCron(ctx, v.cron)
 }
 
-func initBots(service *MailService) {
-	mashaBot := NewMashaBot(service)
+func initBots(c *cron.Cron, service MailService, mashaSkill ChatBot) {
+	mashaBot := NewMashaBot(service, mashaSkill)
 	datingBot := NewDatingBot(service)
-	c := cron.New()
 
 	c.AddFunc(mashaBot.GetCron(), func() {
+		defer metrics.ObserveCron("masha_bot", time.Now())
 		mashaBot.CheckMails()
 	})
 	c.AddFunc(datingBot.GetCron(), func() {
+		defer metrics.ObserveCron("dating_bot", time.Now())
 		datingBot.CheckMails()
 	})
-	c.Start()
+}
 
+func (v *VoiceMail) GetPath() string {
+	return v.path
 }
 
-func (v VoiceMail) GetPath() string {
-	return "/api/dialogs/voice-mail"
+func (v *VoiceMail) GetSkillID() string {
+	return v.skillID
 }
 
-func (v VoiceMail) ApiHandlers(r *mux.Router) {
+func (v *VoiceMail) ApiHandlers(r *mux.Router) {
 	handler := common.Handler()
 	r.Handle("/api/v1/dialogs/voice-mail/receive",
-		handlers.LoggingHandler(
-			os.Stdout,
+		logging.AccessHandler(
 			handler(v.handleReceiveRequest())),
 	).Methods("GET")
 
 	r.Handle("/api/v1/dialogs/voice-mail/send",
-		handlers.LoggingHandler(
-			os.Stdout,
+		logging.AccessHandler(
 			handler(v.handleSendRequest())),
 	).Methods("POST")
 }
 
-func (v VoiceMail) handleReceiveRequest() func(w http.ResponseWriter, r *http.Request) {
+func (v *VoiceMail) handleReceiveRequest() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		authHeader := r.Header.Get("Authorization")
@@ -138,7 +239,7 @@ func (v VoiceMail) handleReceiveRequest() func(w http.ResponseWriter, r *http.Re
 			return
 		}
 
-		user, err := v.mailService.findUser(userId)
+		user, err := v.mailService.FindUser(userId)
 		if err != nil {
 			w.WriteHeader(500)
 			w.Write([]byte("Something went wrong"))
@@ -169,7 +270,7 @@ func (v VoiceMail) handleReceiveRequest() func(w http.ResponseWriter, r *http.Re
 	}
 }
 
-func (v VoiceMail) handleSendRequest() func(w http.ResponseWriter, r *http.Request) {
+func (v *VoiceMail) handleSendRequest() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		authHeader := r.Header.Get("Authorization")
@@ -186,7 +287,7 @@ func (v VoiceMail) handleSendRequest() func(w http.ResponseWriter, r *http.Reque
 			return
 		}
 
-		user, err := v.mailService.findUser(userId)
+		user, err := v.mailService.FindUser(userId)
 		if err != nil {
 			w.WriteHeader(500)
 			w.Write([]byte("Something went wrong"))
@@ -230,27 +331,24 @@ func (v VoiceMail) handleSendRequest() func(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-func (v VoiceMail) Health() (result bool, message string) {
-	if v.mailService.Ping() != nil {
-		log.Printf("Ping failed")
-		v.mailService.Reconnect()
+func (v *VoiceMail) Health() (result bool, message string) {
+	if err := v.mailService.Ping(); err != nil {
+		logger.Warnf("Ping of DB failed: %v", err)
 		return false, "DB is not available"
 	}
 	return true, "OK"
 }
 
-func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
-	return func(request *alice.Request, response *alice.Response) (resp *alice.Response) {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Print("Recovered in f: ", r)
-				response.Text("Произошла ошибка, попробуйте в другой раз")
-				response.Button("Закончить", "", true)
-				resp = response
-			}
-		}()
-		v.Health()
-		currentUser, err := v.mailService.findUser(request.Session.UserID)
+func (v *VoiceMail) HandleRequest() func(request *alice.Request, response *alice.Response) *alice.Response {
+	h := v.HandleRequestContext()
+	return func(request *alice.Request, response *alice.Response) *alice.Response {
+		return h(context.Background(), request, response)
+	}
+}
+
+func (v *VoiceMail) HandleRequestContext() func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+	return func(ctx context.Context, request *alice.Request, response *alice.Response) *alice.Response {
+		currentUser, err := v.mailService.FindUser(request.Session.UserID)
 		if err != nil {
 			response.Text("Произошла ошибка, попробуйте в другой раз")
 			response.Button("Закончить", "", true)
@@ -259,7 +357,7 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 
 		// if new user
 		if currentUser == nil {
-			if containsIgnoreCase(request.Text(), runSkillWords) {
+			if commands.Is(request.Text(), runSkillCommand) {
 				response.Text("Запускаюсь")
 				return response
 			}
@@ -274,7 +372,7 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				Number:    number,
 				BlackList: []int{},
 			}
-			v.states[currentUser.Id] = &UserState{user: currentUser, state: "root"}
+			v.saveState(ctx, currentUser.Id, &UserState{State: "root"})
 			err = v.mailService.SaveUser(currentUser)
 			if err != nil {
 				response.Text("Произошла ошибка, попробуйте ещё раз")
@@ -314,17 +412,27 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 			return response
 		}
 
+		currentState, hasState := v.loadState(ctx, currentUser.Id)
 		if request.Session.New {
-			v.states[currentUser.Id] = &UserState{user: currentUser, state: "root"}
+			currentState = &UserState{State: "root"}
+			hasState = true
 		}
+		defer func() {
+			if hasState {
+				v.saveState(ctx, currentUser.Id, currentState)
+			}
+		}()
 
 		if request.Text() == "" {
 			text := fmt.Sprintf("Здравствуйте! ")
-			count := v.getCountOfMessages(currentUser)
+			messages := v.mailService.GetMessagesForUser(currentUser)
+			count := len(messages)
 
 			if count > 0 {
 				text += fmt.Sprintf("У вас %s %s. \nХотите прослушать?", v.printCount(count), alice.Plural(count, "новое сообщение", "новых сообщения", "новых сообщений"))
-				v.states[currentUser.Id].state = "ask_start_listen_mail"
+				v.showSenders(request, response, messages)
+				currentState.State = "ask_start_listen_mail"
+				hasState = true
 				response.Button("Да", "", true)
 				response.Button("Нет", "", true)
 				response.Button("Помощь", "", true)
@@ -343,17 +451,24 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 		}
 
 		// if there is state
-		if currentState, ok := v.states[request.Session.UserID]; ok {
+		if hasState {
+			statistics.ReportState(ctx, currentState.State)
 
 			// for main menu questions
-			if currentState.state == "root" {
+			if currentState.State == "root" {
+				command := commands.Match(request.Text(),
+					checkMailCommand, newMessageCommand, myNumberCommand, myTokenCommand, addPhoneBookCommand, helpCommand,
+					clearBlackListCommand, blackListCommand, phoneBookCommand, exitCommand, cancelCommand, negativeCommand)
+				statistics.ReportCommand(ctx, command.Name)
 
 				// for check mail box phrase
-				if containsIgnoreCase(request.Text(), checkMailWords) {
-					count := v.getCountOfMessages(currentUser)
+				if command.Name == checkMailCommand {
+					messages := v.mailService.GetMessagesForUser(currentUser)
+					count := len(messages)
 					if count > 0 {
 						response.Text(fmt.Sprintf("У вас %s %s. \nХотите прослушать?", v.printCount(count), alice.Plural(count, "новое сообщение", "новых сообщения", "новых сообщений")))
-						currentState.state = "ask_start_listen_mail"
+						v.showSenders(request, response, messages)
+						currentState.State = "ask_start_listen_mail"
 						response.Button("Да", "", true)
 						response.Button("Нет", "", true)
 					} else {
@@ -365,9 +480,9 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for send new mail phrase
-				if containsIgnoreCase(request.Text(), newMessageWords) {
-					currentState.state = "ask_send_number"
-					currentState.context = &Message{From: currentUser.Number}
+				if command.Name == newMessageCommand {
+					currentState.State = "ask_send_number"
+					currentState.Context = &Message{From: currentUser.Number}
 					response.Text("Назовите номер получателя или имя из записной книжки")
 					if currentUser.LastNumber > 0 && currentUser.LastNumber != 1000 {
 						response.Button(v.printNumber(currentUser.LastNumber), "", true)
@@ -382,7 +497,7 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for my number phrase
-				if containsIgnoreCase(request.Text(), myNumberWords) {
+				if command.Name == myNumberCommand {
 					response.Text(fmt.Sprintf("Ваш номер: %s", v.printNumber(currentUser.Number)))
 					response.Button("Отправить", "", true)
 					response.Button("Проверить почту", "", true)
@@ -391,7 +506,7 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for my token phrase
-				if containsIgnoreCase(request.Text(), myTokenWords) {
+				if command.Name == myTokenCommand {
 					response.Text(fmt.Sprintf("Ваш токен: \n%s", currentUser.Id))
 					response.Button("Перейти, чтобы скопировать", "https://yandex.ru/search/?text="+currentUser.Id, false)
 					response.Button("Отправить", "", true)
@@ -401,21 +516,21 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for phone book words
-				if containsIgnoreCase(request.Text(), addPhoneBookWord) {
-					if currentState.context == nil || currentState.context.To == 0 {
+				if command.Name == addPhoneBookCommand {
+					if currentState.Context == nil || currentState.Context.To == 0 {
 						response.Text("Вы должны отправить сообщение на номер, перед тем как добавить его в записную книжку.")
 						response.Button("Отправить", "", true)
 						response.Button("Проверить почту", "", true)
-						currentState.state = "root"
+						currentState.State = "root"
 						return response
 					}
-					response.Text(fmt.Sprintf("Произнесите имя для номера %s в записной книжке", v.printNumber(currentState.context.To)))
-					currentState.state = "ask_phone_username"
+					response.Text(fmt.Sprintf("Произнесите имя для номера %s в записной книжке", v.printNumber(currentState.Context.To)))
+					currentState.State = "ask_phone_username"
 					return response
 				}
 
 				// for help phrase
-				if containsIgnoreCase(request.Text(), helpWords) {
+				if command.Name == helpCommand {
 					response.Text("Для того, чтобы отправить сообщение, скажите - отправить. " +
 						"\nЧтобы проверить почту, скажите - проверить почту. " +
 						"\nЧтобы узнать свой номер, скажите - мой номер. " +
@@ -430,20 +545,20 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 					return response
 				}
 
-				if containsIgnoreCase(request.Text(), clearBlackListWords) {
+				if command.Name == clearBlackListCommand {
 					currentUser.BlackList = currentUser.BlackList[:0]
 					v.mailService.SaveUser(currentUser)
 
 					text := fmt.Sprintf("Черный список был очищен. Хотите проверить почту?")
 					response.Text(text)
-					currentState.state = "root"
+					currentState.State = "root"
 					response.Button("Отправить", "", true)
 					response.Button("Проверить почту", "", true)
 					response.Button("Выйти", "", true)
 					return response
 				}
 
-				if containsIgnoreCase(request.Text(), blackListWords) {
+				if command.Name == blackListCommand {
 					var numbers []string
 					for i, number := range currentUser.BlackList {
 						if i > 15 {
@@ -462,14 +577,14 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 							"\nДобавить номер в этот список можно только после получения входящего сообщения от пользователя с таким номером."
 					}
 					response.Text(text)
-					currentState.state = "root"
+					currentState.State = "root"
 					response.Button("Очистить черный список", "", true)
 					response.Button("Проверить почту", "", true)
 					response.Button("Назад", "", true)
 					return response
 				}
 
-				if containsIgnoreCase(request.Text(), phoneBookWord) {
+				if command.Name == phoneBookCommand {
 					var numbers []string
 					i := 0
 					for name, number := range currentUser.PhoneBook {
@@ -489,25 +604,24 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 							"\nДобавить номер в этот список можно только после получения входящего сообщения от пользователя с таким номером."
 					}
 					response.Text(text)
-					currentState.state = "root"
+					currentState.State = "root"
 					response.Button("Отправить", "", true)
 					response.Button("Проверить почту", "", true)
 					response.Button("Назад", "", true)
 					return response
 				}
 
-				if strings.EqualFold(request.Text(), "Закончить") {
+				if command.Name == exitCommand {
 					response.EndSession()
 					response.Text("До свидания!")
 					return response
 				}
 
 				// for cancel phrase
-				if containsIgnoreCase(request.Text(), cancelWords) || containsIgnoreCase(request.Text(), negativeWords) {
+				if command.Name == cancelCommand || command.Name == negativeCommand {
 					response.Text("Хорошо, заходите ещё! Скажите - закончить, чтобы выйти из навыка.")
 					response.Button("Оценить навык", "https://dialogs.yandex.ru/store/skills/eacbce8f-govoryashaya-po", false)
 					response.Button("Закончить", "", false)
-					currentState = nil
 					return response
 				}
 
@@ -520,21 +634,22 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				response.Button("Выйти", "", true)
 				return response
 			}
-			if currentState.state == "ask_start_listen_mail" {
+			if currentState.State == "ask_start_listen_mail" {
+				command := commands.Match(request.Text(), acceptCommand, negativeCommand, cancelCommand, helpCommand)
+				statistics.ReportCommand(ctx, command.Name)
 				// for yes phrase
-				if containsIgnoreCase(request.Text(), acceptWords) {
+				if command.Name == acceptCommand {
 					message := v.mailService.ReadMessage(currentUser)
 					if message == nil {
 						response.Text("У вас нет новых сообщений.")
 						response.Button("Отправить", "", true)
 						response.Button("Выйти", "", true)
-						currentState.state = "root"
+						currentState.State = "root"
 						return response
 					}
-					text := fmt.Sprintf("Сообщение от номера: %s. \n%s. \n- \nСлушать дальше или ответить?", v.printNumber(message.From), message.Text)
-					response.Text(text)
-					currentState.context = message
-					currentState.state = "ask_continue_listen_mail"
+					v.readMessage(response, message)
+					currentState.Context = message
+					currentState.State = "ask_continue_listen_mail"
 					response.Button("Дальше", "", true)
 					response.Button("Ответить", "", true)
 					response.Button("В черный список", "", true)
@@ -543,9 +658,9 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for no phrase
-				if containsIgnoreCase(request.Text(), negativeWords) || containsIgnoreCase(request.Text(), cancelWords) {
-					currentState.state = "root"
-					currentState.context = nil
+				if command.Name == negativeCommand || command.Name == cancelCommand {
+					currentState.State = "root"
+					currentState.Context = nil
 
 					response.Text("Окей, хотите что-то ещё?")
 					response.Button("Отправить", "", true)
@@ -557,7 +672,7 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 					return response
 				}
 
-				if containsIgnoreCase(request.Text(), helpWords) {
+				if command.Name == helpCommand {
 					response.Text("Для того, чтобы отправить сообщение, скажите - отправить. " +
 						"\nЧтобы проверить почту, скажите - проверить почту. " +
 						"\nЧтобы узнать свой номер, скажите - мой номер. " +
@@ -577,22 +692,24 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				response.Button("Отмена", "", true)
 				return response
 			}
-			if currentState.state == "ask_continue_listen_mail" {
+			if currentState.State == "ask_continue_listen_mail" {
+				command := commands.Match(request.Text(),
+					acceptCommand, nextCommand, repeatCommand, negativeCommand, cancelCommand, replyCommand, clearBlackListCommand, blackListCommand)
+				statistics.ReportCommand(ctx, command.Name)
 				// for yes phrase
-				if containsIgnoreCase(request.Text(), acceptWords) || containsIgnoreCase(request.Text(), nextWords) {
+				if command.Name == acceptCommand || command.Name == nextCommand {
 					message := v.mailService.ReadMessage(currentUser)
 					if message == nil {
 						response.Text("У вас нет новых сообщений.")
-						currentState.state = "root"
+						currentState.State = "root"
 						response.Button("Отправить", "", true)
 						response.Button("Выйти", "", true)
-						currentState.context = nil
+						currentState.Context = nil
 						return response
 					}
-					text := fmt.Sprintf("Сообщение от номера: %s. \n%s. \n- \nСлушать дальше или ответить?", v.printNumber(message.From), message.Text)
-					response.Text(text)
-					currentState.state = "ask_continue_listen_mail"
-					currentState.context = message
+					v.readMessage(response, message)
+					currentState.State = "ask_continue_listen_mail"
+					currentState.Context = message
 					response.Button("Дальше", "", true)
 					response.Button("Ответить", "", true)
 					response.Button("В черный список", "", true)
@@ -601,14 +718,13 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for repeat phrase
-				if containsIgnoreCase(request.Text(), repeatWords) {
-					if currentState.context == nil {
+				if command.Name == repeatCommand {
+					if currentState.Context == nil {
 						response.Text("Сообщение для повтора не выбрано.")
-						currentState.state = "root"
+						currentState.State = "root"
 						return response
 					}
-					text := fmt.Sprintf("Сообщение от номера: %s. \n%s. \n- \nСлушать дальше или ответить?", v.printNumber(currentState.context.From), currentState.context.Text)
-					response.Text(text)
+					v.readMessage(response, currentState.Context)
 					response.Button("Дальше", "", true)
 					response.Button("Ответить", "", true)
 					response.Button("В черный список", "", true)
@@ -617,9 +733,9 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for no phrase
-				if containsIgnoreCase(request.Text(), negativeWords) || containsIgnoreCase(request.Text(), cancelWords) {
-					currentState.state = "root"
-					currentState.context = nil
+				if command.Name == negativeCommand || command.Name == cancelCommand {
+					currentState.State = "root"
+					currentState.Context = nil
 					response.Text("Окей, хотите что-то ещё?")
 					response.Button("Отправить", "", true)
 					response.Button("Проверить почту", "", true)
@@ -631,28 +747,28 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for reply phrase
-				if containsIgnoreCase(request.Text(), replyWords) {
-					if currentState.context == nil {
+				if command.Name == replyCommand {
+					if currentState.Context == nil {
 						response.Text("Сообщение для ответа не выбрано.")
-						currentState.state = "root"
+						currentState.State = "root"
 						return response
 					}
-					toMessage := &Message{To: currentState.context.From, From: currentUser.Number}
-					currentState.context = toMessage
+					toMessage := &Message{To: currentState.Context.From, From: currentUser.Number}
+					currentState.Context = toMessage
 					text := fmt.Sprintf("Скажите текст сообщения?")
 					response.Text(text)
-					currentState.state = "ask_send_text"
+					currentState.State = "ask_send_text"
 					response.Button("Отмена", "", true)
 					return response
 				}
 
-				if containsIgnoreCase(request.Text(), clearBlackListWords) {
+				if command.Name == clearBlackListCommand {
 					currentUser.BlackList = currentUser.BlackList[:0]
 					v.mailService.SaveUser(currentUser)
 
 					text := fmt.Sprintf("Черный список был очищен. Хотите проверить почту?")
 					response.Text(text)
-					currentState.state = "root"
+					currentState.State = "root"
 					response.Button("Отправить", "", true)
 					response.Button("Проверить почту", "", true)
 					response.Button("Выйти", "", true)
@@ -660,18 +776,18 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for black list phrase
-				if containsIgnoreCase(request.Text(), blackListWords) {
-					if currentState.context == nil {
+				if command.Name == blackListCommand {
+					if currentState.Context == nil {
 						response.Text("Сообщение для блек листа не выбрано.")
-						currentState.state = "root"
+						currentState.State = "root"
 						return response
 					}
-					currentUser.BlackList = append(currentUser.BlackList, currentState.context.From)
+					currentUser.BlackList = append(currentUser.BlackList, currentState.Context.From)
 					v.mailService.SaveUser(currentUser)
 					text := fmt.Sprintf("Номер %s был добавлен в черный список. \nДля того, чтобы очистить список, просто скажите - очистить черный список. "+
-						"Хотите продолжить прослушивание сообщений?", v.printNumber(currentState.context.From))
+						"Хотите продолжить прослушивание сообщений?", v.printNumber(currentState.Context.From))
 					response.Text(text)
-					currentState.state = "ask_after_black_list"
+					currentState.State = "ask_after_black_list"
 					return response
 				}
 
@@ -681,19 +797,20 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				response.Button("Отмена", "", true)
 				return response
 			}
-			if currentState.state == "ask_after_black_list" {
+			if currentState.State == "ask_after_black_list" {
+				command := commands.Match(request.Text(), acceptCommand, nextCommand, clearBlackListCommand)
+				statistics.ReportCommand(ctx, command.Name)
 				// for yes phrase
-				if containsIgnoreCase(request.Text(), acceptWords) || containsIgnoreCase(request.Text(), nextWords) {
+				if command.Name == acceptCommand || command.Name == nextCommand {
 					message := v.mailService.ReadMessage(currentUser)
 					if message == nil {
 						response.Text("У вас нет новых сообщений.")
-						currentState.state = "root"
+						currentState.State = "root"
 						return response
 					}
-					text := fmt.Sprintf("Сообщение от номера %s. \n%s. \n- \nСлушать дальше или ответить?", v.printNumber(message.From), message.Text)
-					response.Text(text)
-					currentState.state = "ask_continue_listen_mail"
-					currentState.context = message
+					v.readMessage(response, message)
+					currentState.State = "ask_continue_listen_mail"
+					currentState.Context = message
 					response.Button("Дальше", "", true)
 					response.Button("Ответить", "", true)
 					response.Button("В черный список", "", true)
@@ -701,20 +818,20 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 					return response
 				}
 
-				if containsIgnoreCase(request.Text(), clearBlackListWords) {
+				if command.Name == clearBlackListCommand {
 					currentUser.BlackList = currentUser.BlackList[:0]
 					v.mailService.SaveUser(currentUser)
 
 					text := fmt.Sprintf("Черный список был очищен. Хотите проверить почту?")
 					response.Text(text)
-					currentState.state = "root"
+					currentState.State = "root"
 					response.Button("Отправить", "", true)
 					response.Button("Проверить почту", "", true)
 					response.Button("Выйти", "", true)
 					return response
 				}
 
-				currentState.state = "root"
+				currentState.State = "root"
 				response.Text("Окей, хотите что-то ещё?")
 				response.Button("Отправить", "", true)
 				response.Button("Проверить почту", "", true)
@@ -725,11 +842,13 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				return response
 
 			}
-			if currentState.state == "ask_send_number" {
+			if currentState.State == "ask_send_number" {
+				command := commands.Match(request.Text(), reviewCommand, datingCommand)
+				statistics.ReportCommand(ctx, command.Name)
 				// for cancel phrase
-				if equalsIgnoreCase(request.Text(), cancelWords) {
-					currentState.state = "root"
-					currentState.context = nil
+				if commands.MatchExact(request.Text(), cancelCommand).Name == cancelCommand {
+					currentState.State = "root"
+					currentState.Context = nil
 					response.Text("Окей, хотите что-то ещё?")
 					response.Button("Отправить новое", "", true)
 					response.Button("Проверить почту", "", true)
@@ -740,15 +859,15 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 					return response
 				}
 
-				if currentState.context == nil {
+				if currentState.Context == nil {
 					response.Text("Скажите - отправить, для того чтобы отправить новое сообщение")
-					currentState.state = "root"
+					currentState.State = "root"
 					return response
 				}
 				var to int
-				if containsIgnoreCase(request.Text(), reviewWords) {
+				if command.Name == reviewCommand {
 					to = 1000
-				} else if containsIgnoreCase(request.Text(), datingWords) {
+				} else if command.Name == datingCommand {
 					to = 7070
 				} else {
 					var number string
@@ -759,7 +878,7 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 					var err error
 					to, err = strconv.Atoi(number)
 					if err != nil {
-						if number, ok := currentUser.PhoneBook[strings.ToUpper(request.Text())]; ok {
+						if number, ok := findPhoneBookNumber(currentUser, request.Text()); ok {
 							to = number
 						} else {
 							response.Text("Вам нужно назвать четырёхзначный номер получателя или имя из записной книжки. " +
@@ -770,7 +889,7 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 						}
 					}
 				}
-				currentState.context.To = to
+				currentState.Context.To = to
 				text := fmt.Sprintf("Произнесите текст сообщения")
 				if to == 1000 {
 					text = fmt.Sprintf("Произнесите текст отзыва или предложения")
@@ -778,23 +897,25 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 					text = fmt.Sprintf("Произнесите текст сообщения для случайного пользователя")
 				}
 				response.Text(text)
-				currentState.state = "ask_send_text"
+				currentState.State = "ask_send_text"
 				response.Button("Отмена", "", true)
 				return response
 			}
-			if currentState.state == "ask_send_text" {
+			if currentState.State == "ask_send_text" {
+				command := commands.MatchExact(request.Text(), helpCommand, cancelCommand)
+				statistics.ReportCommand(ctx, command.Name)
 
 				// for help phrase
-				if equalsIgnoreCase(request.Text(), helpWords) {
+				if command.Name == helpCommand {
 					response.Text("Произнесите текст сообщения, или скажите - отмена, чтобы вернуться в главное меню.")
 					response.Button("Отмена", "", true)
 					return response
 				}
 
 				// for no phrase
-				if equalsIgnoreCase(request.Text(), cancelWords) {
-					currentState.state = "root"
-					currentState.context = nil
+				if command.Name == cancelCommand {
+					currentState.State = "root"
+					currentState.Context = nil
 					response.Text("Окей, хотите что-то ещё?")
 					response.Button("Отправить новое", "", true)
 					response.Button("Проверить почту", "", true)
@@ -805,37 +926,39 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 					return response
 				}
 
-				if currentState.context == nil {
+				if currentState.Context == nil {
 					response.Text("Скажите - отправить новое сообщение, для того чтобы отправить")
-					currentState.state = "root"
+					currentState.State = "root"
 					return response
 				}
 
-				currentState.context.Text = request.Text()
-				currentState.state = "ask_send_confirm"
-				response.Text(fmt.Sprintf("Отправляю сообщение: \n- \n%s \n- \nНа номер: %s. \nВсё верно?", currentState.context.Text, v.printNumber(currentState.context.To)))
+				currentState.Context.Text = request.Text()
+				currentState.State = "ask_send_confirm"
+				response.Text(fmt.Sprintf("Отправляю сообщение: \n- \n%s \n- \nНа номер: %s. \nВсё верно?", currentState.Context.Text, v.printNumber(currentState.Context.To)))
 				response.Button("Да", "", true)
 				response.Button("Нет", "", true)
 				return response
 
 			}
-			if currentState.state == "ask_send_confirm" {
+			if currentState.State == "ask_send_confirm" {
+				command := commands.Match(request.Text(), acceptCommand, sendCommand, negativeCommand, cancelCommand)
+				statistics.ReportCommand(ctx, command.Name)
 				// for yes phrase
-				if containsIgnoreCase(request.Text(), acceptWords) || containsIgnoreCase(request.Text(), sendWords) {
-					currentState.state = "root"
-					err := v.mailService.SendMessage(currentState.context)
+				if command.Name == acceptCommand || command.Name == sendCommand {
+					currentState.State = "root"
+					err := v.mailService.SendMessage(currentState.Context)
 					if err != nil {
 						response.Text("Произошла ошибка, попробуйте ещё раз")
 						response.Button("Отмена", "", true)
 						return response
 					}
-					if currentState.context.To == 1000 {
+					if currentState.Context.To == 1000 {
 						currentUser.Reviewed = true
-					} else if currentState.context.To == 7070 {
+					} else if currentState.Context.To == 7070 {
 						currentUser.DateFree = true
 					} else {
 						currentUser.PreLastNumber = currentUser.LastNumber
-						currentUser.LastNumber = currentState.context.To
+						currentUser.LastNumber = currentState.Context.To
 					}
 
 					err = v.mailService.SaveUser(currentUser)
@@ -844,12 +967,12 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 						response.Button("Отмена", "", true)
 						return response
 					}
-					if currentState.context.To == 1000 {
+					if currentState.Context.To == 1000 {
 						response.Text("Спасибо за отзыв! Вы также можете оставить свой отзыв в Яндекс каталоге навыков.")
 						response.Button("Оценить навык", "https://dialogs.yandex.ru/store/skills/eacbce8f-govoryashaya-po", false)
 						response.Button("Проверить почту", "", true)
 						response.Button("Отправить новое", "", true)
-					} else if currentState.context.To != 7070 && phoneBookedNumber(currentUser, currentState.context.To) == nil {
+					} else if currentState.Context.To != 7070 && phoneBookedNumber(currentUser, currentState.Context.To) == nil {
 						response.Text("Сообщение отправлено! Вы можете добавить номер в записную книжку. Хотите что то ещё?")
 						response.Button("Добавить в записную книжку", "", true)
 						response.Button("Проверить почту", "", true)
@@ -866,9 +989,9 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				// for no phrase
-				if containsIgnoreCase(request.Text(), negativeWords) || containsIgnoreCase(request.Text(), cancelWords) {
-					currentState.state = "root"
-					currentState.context = nil
+				if command.Name == negativeCommand || command.Name == cancelCommand {
+					currentState.State = "root"
+					currentState.Context = nil
 					response.Text("Окей, хотите что-то ещё?")
 					response.Button("Отправить новое", "", true)
 					response.Button("Проверить почту", "", true)
@@ -885,26 +1008,28 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				return response
 			}
 
-			if currentState.state == "ask_phone_username" {
-				if currentState.context == nil {
+			if currentState.State == "ask_phone_username" {
+				command := commands.Match(request.Text(), datingCommand, reviewCommand, negativeCommand, cancelCommand)
+				statistics.ReportCommand(ctx, command.Name)
+				if currentState.Context == nil {
 					response.Text("Произошла ошибка, попробуйте ещё раз")
-					currentState.state = "root"
+					currentState.State = "root"
 					response.Button("Отправить новое", "", true)
 					response.Button("Проверить почту", "", true)
 					response.Button("Выйти", "", true)
 					return response
 				}
 				// for yes phrase
-				if containsIgnoreCase(request.Text(), datingWords) || containsIgnoreCase(request.Text(), reviewWords) {
+				if command.Name == datingCommand || command.Name == reviewCommand {
 					response.Text("Вы не можете использовать это имя, пожалуйста, назовите другое.")
 					response.Button("Отмена", "", true)
 					return response
 				}
 
 				// for no phrase
-				if containsIgnoreCase(request.Text(), negativeWords) || containsIgnoreCase(request.Text(), cancelWords) {
-					currentState.state = "root"
-					currentState.context = nil
+				if command.Name == negativeCommand || command.Name == cancelCommand {
+					currentState.State = "root"
+					currentState.Context = nil
 					response.Text("Окей, хотите что-то ещё?")
 					response.Button("Отправить новое", "", true)
 					response.Button("Проверить почту", "", true)
@@ -916,28 +1041,28 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 				}
 
 				if request.Text() != "" {
-					currentUser.PhoneBook[strings.ToUpper(request.Text())] = currentState.context.To
+					currentUser.PhoneBook[strings.ToUpper(request.Text())] = currentState.Context.To
 					err := v.mailService.SaveUser(currentUser)
 					if err != nil {
 						response.Text("Произошла ошибка, попробуйте ещё раз")
 						response.Button("Выйти", "", true)
 						return response
 					}
-					response.Text(fmt.Sprintf("Для номера: %s, установлено имя: %s, вы можете использовать его для отправки сообщений. \nХотите что то ещё?", v.printNumber(currentState.context.To), request.Text()))
+					response.Text(fmt.Sprintf("Для номера: %s, установлено имя: %s, вы можете использовать его для отправки сообщений. \nХотите что то ещё?", v.printNumber(currentState.Context.To), request.Text()))
 					response.Button("Отправить новое", "", true)
 					response.Button("Проверить почту", "", true)
 					response.Button("Выйти", "", true)
-					currentState.context = nil
-					currentState.state = "root"
+					currentState.Context = nil
+					currentState.State = "root"
 					return response
 				}
 
-				response.Text(fmt.Sprintf("Назовите имя для номера - %s", v.printNumber(currentState.context.To)))
+				response.Text(fmt.Sprintf("Назовите имя для номера - %s", v.printNumber(currentState.Context.To)))
 				response.Button("Да", "", true)
 				response.Button("Отмена", "", true)
 				return response
 			} else {
-				v.states[currentUser.Id] = &UserState{user: currentUser, state: "root"}
+				*currentState = UserState{State: "root"}
 				response.Text("Что пожелаете?")
 				response.Button("Отправить новое сообщение", "", true)
 				response.Button("Проверить почту", "", true)
@@ -953,57 +1078,141 @@ func (v VoiceMail) HandleRequest() func(request *alice.Request, response *alice.
 	}
 }
 
-func phoneBookedNumber(user *User, to int) *string {
-	for name, number := range user.PhoneBook {
-		if number == to {
-			return &name
+// Intent `send_message` is configured in skill console and fills the whole send flow in one phrase,
+// for example "отправь сообщение на номер 12345 с текстом привет".
+// Slots: `number` or `name` from phone book, and optional `text`.
+func (v *VoiceMail) IntentHandlers() map[string]nlu.Handler {
+	return map[string]nlu.Handler{
+		"send_message": v.handleSendMessageIntent,
+	}
+}
+
+func (v *VoiceMail) handleSendMessageIntent(ctx context.Context, request *alice.Request, intent nlu.Intent, response *alice.Response) *alice.Response {
+	currentUser, err := v.mailService.FindUser(request.Session.UserID)
+	if err != nil || currentUser == nil {
+		return nil
+	}
+	// phrase in the middle of other flow, e.g. text of message, is handled by the flow itself
+	if state, ok := v.loadState(ctx, currentUser.Id); ok && state.State != "root" && !request.Session.New {
+		return nil
+	}
+
+	to := 0
+	if slot, ok := intent.Slot("number"); ok {
+		to, _ = slot.AsInt()
+	} else if slot, ok := intent.Slot("name"); ok {
+		if name, ok := slot.AsString(); ok {
+			to, _ = findPhoneBookNumber(currentUser, name)
 		}
 	}
-	return nil
+	if to == 0 {
+		return nil
+	}
+
+	currentState := &UserState{State: "ask_send_text", Context: &Message{From: currentUser.Number, To: to}}
+	if slot, ok := intent.Slot("text"); ok {
+		if text, ok := slot.AsString(); ok && text != "" {
+			currentState.State = "ask_send_confirm"
+			currentState.Context.Text = text
+		}
+	}
+	v.saveState(ctx, currentUser.Id, currentState)
+
+	if currentState.State == "ask_send_confirm" {
+		response.Text(fmt.Sprintf("Отправляю сообщение: \n- \n%s \n- \nНа номер: %s. \nВсё верно?", currentState.Context.Text, v.printNumber(currentState.Context.To)))
+		response.Button("Да", "", true)
+		response.Button("Нет", "", true)
+		return response
+	}
+	response.Text("Произнесите текст сообщения")
+	response.Button("Отмена", "", true)
+	return response
 }
 
-func (v VoiceMail) getCountOfMessages(currentUser *User) int {
-	return len(v.mailService.GetMessagesForUser(currentUser))
+func (v *VoiceMail) loadState(ctx context.Context, userId string) (*UserState, bool) {
+	state := &UserState{}
+	ok, err := v.states.Get(ctx, userId, state)
+	if err != nil {
+		logger.Errorf("Cannot load state of user %s: %v", logging.ID(userId), err)
+		return state, false
+	}
+	return state, ok
 }
 
-func containsIgnoreCase(message string, wordsToCheck []string) bool {
-	for _, word := range wordsToCheck {
-		if strings.Contains(strings.ToUpper(message), strings.ToUpper(word)) {
-			return true
-		}
+func (v *VoiceMail) saveState(ctx context.Context, userId string, state *UserState) {
+	if err := v.states.Set(ctx, userId, state); err != nil {
+		logger.Errorf("Cannot save state of user %s: %v", logging.ID(userId), err)
 	}
-	return false
 }
 
-func equalsIgnoreCase(message string, wordsToCheck []string) bool {
-	for _, word := range wordsToCheck {
-		if strings.EqualFold(message, word) {
-			return true
+func phoneBookedNumber(user *User, to int) *string {
+	for name, number := range user.PhoneBook {
+		if number == to {
+			return &name
 		}
 	}
-	return false
+	return nil
 }
 
-func (v VoiceMail) generateNumber(userId string) (int, error) {
+// findPhoneBookNumber looks up number by name in phone book of user. Names are compared fuzzily, as speech recognition can misspell them.
+func findPhoneBookNumber(user *User, name string) (int, bool) {
+	if number, ok := user.PhoneBook[strings.ToUpper(name)]; ok {
+		return number, true
+	}
+	var names []string
+	for n := range user.PhoneBook {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if i, ok := fuzzy.Closest(name, names); ok {
+		return user.PhoneBook[names[i]], true
+	}
+	return 0, false
+}
+
+func (v *VoiceMail) generateNumber(userId string) (int, error) {
 	v.mux.Lock()
 
 	rand.Seed(int64(hash(userId)))
 	number := 1000 + rand.Intn(9999-1000)
 	defer v.mux.Unlock()
 	number = 10000 + rand.Intn(99999-10000)
-	number, err, done := v.mailService.checkAndGenerateId(number)
+	number, err, done := v.mailService.CheckAndGenerateId(number)
 	if done {
 		return number, err
 	}
 	return 0, errors.New("COLLISION error when generating unique id")
 }
 
-func (v VoiceMail) printNumber(number int) string {
+// showSenders shows senders of new messages on screen. Speakers tell only count of messages, and user listens to them one by one.
+func (v *VoiceMail) showSenders(request *alice.Request, response *alice.Response, messages []Message) {
+	if !common.HasScreen(request) {
+		return
+	}
+	items := make([]reply.Item, 0, len(messages))
+	for _, message := range messages {
+		items = append(items, reply.Item{Title: "От номера " + v.printNumber(message.From)})
+	}
+	reply.New(response).ItemsList("Новые сообщения", items, "").Build()
+}
+
+// readMessage reads message with pauses after number of sender and before question, instead of pauses by dashes.
+func (v *VoiceMail) readMessage(response *alice.Response, message *Message) {
+	reply.New(response).
+		Textf("Сообщение от номера: %s. \n", v.printNumber(message.From)).
+		Pause(500).
+		Textf("%s. \n", message.Text).
+		Pause(700).
+		Text("Слушать дальше или ответить?").
+		Build()
+}
+
+func (v *VoiceMail) printNumber(number int) string {
 	strNumber := strings.Split(strconv.Itoa(number), "")
 	return fmt.Sprintf("%s", strings.Join(strNumber, "-"))
 }
 
-func (v VoiceMail) printCount(number int) string {
+func (v *VoiceMail) printCount(number int) string {
 	countStr := strconv.Itoa(number)
 	if number == 1 {
 		countStr = "одно"
@@ -0,0 +1,192 @@
+package voice_mail
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"yandex-dialogs/harness"
+)
+
+func newTestVoiceMail(t *testing.T, users ...*User) (*VoiceMail, *MemoryMailService, func()) {
+	service := NewMemoryMailService()
+	for _, user := range users {
+		if err := service.SaveUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deps := harness.NewDependencies(map[string]string{"MASHA_URL": ""})
+	dialog := NewVoiceMailWithService(service)
+	if err := dialog.Init(deps); err != nil {
+		t.Fatal(err)
+	}
+	return dialog, service, func() {
+		dialog.Close(context.Background())
+		deps.Close()
+	}
+}
+
+func TestNewUser(t *testing.T) {
+	dialog, service, closeDialog := newTestVoiceMail(t)
+	defer closeDialog()
+
+	harness.NewConversation(t, dialog, "new-user").Run(
+		harness.Step{Say: "", Text: []string{"Добро пожаловать в говорящую почту!"}, Buttons: []string{"Отправить", "Проверить почту", "Помощь"}},
+		harness.Step{Say: "мой номер", Text: []string{"Ваш номер"}},
+	)
+
+	user, _ := service.FindUser("new-user")
+	if user == nil {
+		t.Fatal("user is not saved")
+	}
+	if messages := service.GetMessagesForUser(user); len(messages) != 2 || messages[0].From != 1000 {
+		t.Errorf("expected 2 welcome messages from 1000, got %+v", messages)
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	alice := &User{Id: "alice", Number: 11111, BlackList: []int{}}
+	bob := &User{Id: "bob", Number: 22222, BlackList: []int{}}
+	dialog, service, closeDialog := newTestVoiceMail(t, alice, bob)
+	defer closeDialog()
+
+	harness.NewConversation(t, dialog, "alice").Run(
+		harness.Step{Say: "", Text: []string{"У вас нет новых сообщений"}},
+		harness.Step{Say: "отправить", Text: []string{"Назовите номер получателя"},
+			Buttons: []string{"Случайное знакомство", "Оставить отзыв", "Отмена"}},
+		harness.Step{Say: strconv.Itoa(bob.Number), Text: []string{"Произнесите текст сообщения"}, Buttons: []string{"Отмена"}},
+		harness.Step{Say: "Привет, Боб", Text: []string{"Привет, Боб", "2-2-2-2-2", "Всё верно?"}, Buttons: []string{"Да", "Нет"}},
+		harness.Step{Say: "да", Text: []string{"Сообщение отправлено!"}},
+		harness.Step{Say: "отправить", Buttons: []string{"2-2-2-2-2", "Случайное знакомство", "Оставить отзыв", "Отмена"}},
+		harness.Step{Say: "отмена", Text: []string{"Окей, хотите что-то ещё?"}},
+	)
+
+	messages := service.GetMessagesForUser(bob)
+	if len(messages) != 1 || messages[0].From != alice.Number || messages[0].Text != "Привет, Боб" {
+		t.Errorf("expected message from alice, got %+v", messages)
+	}
+	if user, _ := service.FindUser("alice"); user.LastNumber != bob.Number {
+		t.Errorf("expected last number %d, got %d", bob.Number, user.LastNumber)
+	}
+}
+
+func TestSendMessageToUnknownNumber(t *testing.T) {
+	dialog, service, closeDialog := newTestVoiceMail(t, &User{Id: "alice", Number: 11111, BlackList: []int{}})
+	defer closeDialog()
+
+	harness.NewConversation(t, dialog, "alice").Run(
+		harness.Step{Say: "отправить"},
+		harness.Step{Say: "кому-нибудь", Text: []string{"Вам нужно назвать четырёхзначный номер"}},
+		harness.Step{Say: "33333", Text: []string{"Произнесите текст сообщения"}},
+		harness.Step{Say: "есть кто?"},
+		harness.Step{Say: "да", Text: []string{"Сообщение отправлено!"}},
+	)
+
+	if messages := service.GetMessagesForUser(&User{Number: 33333}); len(messages) != 0 {
+		t.Errorf("expected message to be dropped, got %+v", messages)
+	}
+}
+
+func TestListenMessages(t *testing.T) {
+	bob := &User{Id: "bob", Number: 22222, BlackList: []int{}}
+	dialog, service, closeDialog := newTestVoiceMail(t, bob)
+	defer closeDialog()
+	service.SendMessage(&Message{From: 1000, To: bob.Number, Text: "Первое"})
+	service.SendMessage(&Message{From: 1000, To: bob.Number, Text: "Второе"})
+
+	conversation := harness.NewConversation(t, dialog, "bob")
+	conversation.Run(
+		harness.Step{Say: "", Text: []string{"У вас 2 новых сообщения", "Хотите прослушать?"}, Buttons: []string{"Да", "Нет", "Помощь"}},
+		harness.Step{Say: "да", Text: []string{"Сообщение от номера: 1-0-0-0", "Первое"},
+			Buttons: []string{"Дальше", "Ответить", "В черный список", "Отмена"}},
+		harness.Step{Say: "повтори", Text: []string{"Первое"}},
+		harness.Step{Say: "дальше", Text: []string{"Второе"}},
+		harness.Step{Say: "дальше", Text: []string{"У вас нет новых сообщений"}, Buttons: []string{"Отправить", "Выйти"}},
+		harness.Step{Say: "закончить", Text: []string{"До свидания!"}, EndSession: true},
+		harness.Step{Say: "", NewSession: true, Text: []string{"У вас нет новых сообщений"}},
+	)
+}
+
+func TestSendersAreShownOnScreenOnly(t *testing.T) {
+	bob := &User{Id: "bob", Number: 22222, BlackList: []int{}}
+	dialog, service, closeDialog := newTestVoiceMail(t, bob)
+	defer closeDialog()
+	service.SendMessage(&Message{From: 1000, To: bob.Number, Text: "Первое"})
+
+	response := harness.NewConversation(t, dialog, "bob").Say("")
+	if card := response.Response.Card; card == nil || len(card.Items) != 1 || card.Items[0].Title != "От номера 1-0-0-0" ||
+		card.Items[0].Description != "" {
+		t.Errorf("expected sender on screen, got %+v", card)
+	}
+	response = harness.NewConversation(t, dialog, "bob").WithoutScreen().Say("")
+	if response.Response.Card != nil {
+		t.Errorf("expected only count of messages on speaker, got %+v", response.Response.Card)
+	}
+}
+
+func TestReplyToMessage(t *testing.T) {
+	alice := &User{Id: "alice", Number: 11111, BlackList: []int{}}
+	bob := &User{Id: "bob", Number: 22222, BlackList: []int{}}
+	dialog, service, closeDialog := newTestVoiceMail(t, alice, bob)
+	defer closeDialog()
+	service.SendMessage(&Message{From: alice.Number, To: bob.Number, Text: "Как дела?"})
+
+	harness.NewConversation(t, dialog, "bob").Run(
+		harness.Step{Say: "проверить почту", Text: []string{"У вас одно новое сообщение"}},
+		harness.Step{Say: "да", Text: []string{"1-1-1-1-1", "Как дела?"}},
+		harness.Step{Say: "ответить", Text: []string{"Скажите текст сообщения"}},
+		harness.Step{Say: "Отлично", Text: []string{"На номер: 1-1-1-1-1"}},
+		harness.Step{Say: "да", Text: []string{"Сообщение отправлено!"}},
+	)
+
+	if messages := service.GetMessagesForUser(alice); len(messages) != 1 || messages[0].Text != "Отлично" {
+		t.Errorf("expected reply to alice, got %+v", messages)
+	}
+}
+
+func TestBlackList(t *testing.T) {
+	alice := &User{Id: "alice", Number: 11111, BlackList: []int{}}
+	bob := &User{Id: "bob", Number: 22222, BlackList: []int{}}
+	dialog, service, closeDialog := newTestVoiceMail(t, alice, bob)
+	defer closeDialog()
+	service.SendMessage(&Message{From: alice.Number, To: bob.Number, Text: "Спам"})
+
+	harness.NewConversation(t, dialog, "bob").Run(
+		harness.Step{Say: "", Text: []string{"У вас одно новое сообщение"}},
+		harness.Step{Say: "да", Text: []string{"Спам"}},
+		harness.Step{Say: "забанить", Text: []string{"Номер 1-1-1-1-1 был добавлен в черный список"}},
+		harness.Step{Say: "нет", Text: []string{"Окей, хотите что-то ещё?"}},
+		harness.Step{Say: "черный список", Text: []string{"Ваш черный список номеров", "1-1-1-1-1"},
+			Buttons: []string{"Очистить черный список", "Проверить почту", "Назад"}},
+	)
+
+	harness.NewConversation(t, dialog, "alice").Run(
+		harness.Step{Say: "отправить"},
+		harness.Step{Say: strconv.Itoa(bob.Number)},
+		harness.Step{Say: "Ещё спам"},
+		harness.Step{Say: "да", Text: []string{"Сообщение отправлено!"}},
+	)
+	if messages := service.GetMessagesForUser(bob); len(messages) != 0 {
+		t.Fatalf("expected message from black list to be dropped, got %+v", messages)
+	}
+
+	harness.NewConversation(t, dialog, "bob").Run(
+		harness.Step{Say: "очистить черный список", Text: []string{"Черный список был очищен"}},
+		harness.Step{Say: "черный список", Text: []string{"Ваш черный список пуст"}},
+	)
+	service.SendMessage(&Message{From: alice.Number, To: bob.Number, Text: "Больше не спам"})
+	if messages := service.GetMessagesForUser(bob); len(messages) != 1 {
+		t.Errorf("expected message after clearing black list, got %+v", messages)
+	}
+}
+
+func TestMisrecognizedTokenCommand(t *testing.T) {
+	dialog, _, closeDialog := newTestVoiceMail(t, &User{Id: "alice", Number: 11111, BlackList: []int{}})
+	defer closeDialog()
+
+	for _, say := range []string{"токен", "токинг", "такен", "мой токинг"} {
+		harness.NewConversation(t, dialog, "alice").Run(
+			harness.Step{Say: ""},
+			harness.Step{Say: say, Text: []string{"Ваш токен"}},
+		)
+	}
+}